@@ -0,0 +1,115 @@
+create table if not exists `chapter_contents` (
+  `book_id` varchar(64) not null,
+  `chapter_id` varchar(64) not null,
+  `host` varchar(64) not null,
+  `checksum` char(64) not null,
+  `fetched_at` bigint not null,
+  `content` mediumtext not null,
+  primary key (`book_id`, `chapter_id`)
+) default charset=utf8mb4;
+
+create table if not exists `chapters` (
+  `book_id` varchar(64) not null,
+  `native_id` int not null,
+  `id` varchar(64) not null,
+  `title` varchar(256) not null,
+  `url` varchar(512) not null,
+  `vip` tinyint(1) not null default 0,
+  primary key (`book_id`, `native_id`),
+  key `idx_book_chapter` (`book_id`, `id`)
+) default charset=utf8mb4;
+
+create table if not exists `votes_table` (
+  `id` bigint not null auto_increment,
+  `book_id` varchar(64) not null,
+  `client_id` varchar(64) not null,
+  `day` char(10) not null,
+  `created_at` bigint not null,
+  `revoked` tinyint(1) not null default 0,
+  primary key (`id`),
+  key `idx_client_day` (`client_id`, `day`),
+  key `idx_book` (`book_id`)
+) default charset=utf8mb4;
+
+create table if not exists `book_readers` (
+  `book_id` varchar(64) not null,
+  `client_id` varchar(64) not null,
+  `day` char(10) not null,
+  primary key (`book_id`, `client_id`, `day`),
+  key `idx_day` (`day`)
+) default charset=utf8mb4;
+
+create table if not exists `book_opens` (
+  `book_id` varchar(64) not null,
+  `total_opens` bigint not null default 0,
+  primary key (`book_id`)
+) default charset=utf8mb4;
+
+create table if not exists `shelf_books` (
+  `client_id` varchar(64) not null,
+  `book_id` varchar(64) not null,
+  `position` int not null,
+  `added_at` bigint not null,
+  `opened_at` bigint not null,
+  `seen_native_id` int not null default -1,
+  primary key (`client_id`, `book_id`)
+) default charset=utf8mb4;
+
+create table if not exists `reading_progress` (
+  `client_id` varchar(64) not null,
+  `book_id` varchar(64) not null,
+  `native_id` int not null,
+  `read_offset` int not null,
+  `updated_at` bigint not null,
+  primary key (`client_id`, `book_id`),
+  key `idx_client_updated` (`client_id`, `updated_at`)
+) default charset=utf8mb4;
+
+create table if not exists `accounts` (
+  `id` bigint not null auto_increment,
+  `name` varchar(64) not null,
+  `password_hash` varchar(128) not null,
+  `created_at` bigint not null,
+  primary key (`id`),
+  unique key `uk_name` (`name`)
+) default charset=utf8mb4;
+
+create table if not exists `account_clients` (
+  `client_id` varchar(64) not null,
+  `account_id` bigint not null,
+  primary key (`client_id`),
+  key `idx_account` (`account_id`)
+) default charset=utf8mb4;
+
+create table if not exists `client_secrets` (
+  `client_id` varchar(64) not null,
+  `secret_hash` char(64) not null,
+  primary key (`client_id`)
+) default charset=utf8mb4;
+
+create table if not exists `recommend_versions` (
+  `id` bigint not null auto_increment,
+  `clazz` varchar(64) not null,
+  `version` int not null,
+  `author` varchar(64) not null,
+  `created_at` bigint not null,
+  `books` mediumtext not null,
+  `rollback_of` int not null default 0,
+  primary key (`id`),
+  unique key `uk_clazz_version` (`clazz`, `version`)
+) default charset=utf8mb4;
+
+create table if not exists `recommend_schedules` (
+  `id` bigint not null auto_increment,
+  `clazz` varchar(64) not null,
+  `author` varchar(64) not null,
+  `publish_at` bigint not null,
+  `expire_at` bigint not null default 0,
+  `state` varchar(16) not null,
+  `version` int not null default 0,
+  `created_at` bigint not null,
+  `books` mediumtext not null,
+  primary key (`id`),
+  key `idx_state` (`state`, `publish_at`),
+  key `idx_clazz` (`clazz`)
+) default charset=utf8mb4;
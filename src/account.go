@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTokenTTL    = 30 * 24 * 3600
+	minPasswordLength  = 6
+	minClientSecret    = 16
+	maxAccountNameSize = 64
+	accountOwnerPrefix = "account:"
+)
+
+type Account struct {
+	Id           int64  `json:"id"`
+	Name         string `json:"name"`
+	PasswordHash string `json:"-"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type AccountInfo struct {
+	*Account
+	ClientIds []string `json:"client_ids"`
+}
+
+type AccountSession struct {
+	Account   *AccountInfo `json:"account"`
+	Token     string       `json:"token"`
+	ExpiresAt int64        `json:"expires_at"`
+}
+
+type accountReqP struct {
+	Name         string `json:"name"`
+	Password     string `json:"password"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Token        string `json:"token"`
+}
+
+func parseAccountReqBody(body interface{}) (*accountReqP, error) {
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return nil, err
+	}
+	var p accountReqP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func tokenKey() ([]byte, error) {
+	if "" == cfg.Account.TokenSecret {
+		return nil, errors.New("No account token secret configured")
+	}
+	return []byte(cfg.Account.TokenSecret), nil
+}
+
+func tokenMac(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// signToken returns "<payload>.<hmac>" where payload is "<account id>.<expires at>",
+// both parts base64url encoded.
+func signToken(key []byte, accountId int64, expiresAt int64) string {
+	payload := fmt.Sprintf("%d.%d", accountId, expiresAt)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(tokenMac(key, payload))
+}
+
+func verifyToken(key []byte, token string, now time.Time) (int64, error) {
+	errInvalid := errors.New("Invalid token")
+	parts := strings.Split(token, ".")
+	if 2 != len(parts) {
+		return 0, errInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if nil != err {
+		return 0, errInvalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if nil != err || !hmac.Equal(sum, tokenMac(key, string(payload))) {
+		return 0, errInvalid
+	}
+
+	fields := strings.Split(string(payload), ".")
+	if 2 != len(fields) {
+		return 0, errInvalid
+	}
+	accountId, err := strconv.ParseInt(fields[0], 10, 64)
+	if nil != err {
+		return 0, errInvalid
+	}
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if nil != err || now.Unix() >= expiresAt {
+		return 0, errInvalid
+	}
+	return accountId, nil
+}
+
+func accountOwner(accountId int64) string {
+	return accountOwnerPrefix + strconv.FormatInt(accountId, 10)
+}
+
+// ownerId returns the key shelves, progress, votes and reads are stored
+// under: the account of a valid token or the anonymous client id itself.
+// A client linked to an account has to send the token.
+func (mgr *BookMgr) ownerId(clientId string, token string) (string, error) {
+	if "" != token {
+		accountId, err := verifyToken(mgr.tokenKey, token, time.Now())
+		if nil != err {
+			return "", err
+		}
+		return accountOwner(accountId), nil
+	}
+	if "" == clientId || strings.HasPrefix(clientId, accountOwnerPrefix) {
+		return "", errors.New("Invalid parameter")
+	}
+	accountId, err := mgr.store.GetClientAccount(clientId)
+	if nil != err {
+		return "", err
+	}
+	if 0 < accountId {
+		return "", errors.New("Token required")
+	}
+	return clientId, nil
+}
+
+// VerifyToken rejects a session token that is malformed, forged or expired.
+// An empty token is an anonymous request and passes.
+func (mgr *BookMgr) VerifyToken(token string) error {
+	if "" == token {
+		return nil
+	}
+	_, err := verifyToken(mgr.tokenKey, token, time.Now())
+	return err
+}
+
+func (mgr *BookMgr) newSession(account *Account) (*AccountSession, error) {
+	clientIds, err := mgr.store.QueryAccountClients(account.Id)
+	if nil != err {
+		return nil, err
+	}
+	expiresAt := time.Now().Unix() + int64(cacheTTL(cfg.Account.TokenTTL, defaultTokenTTL)/time.Second)
+	return &AccountSession{
+		Account:   &AccountInfo{Account: account, ClientIds: clientIds},
+		Token:     signToken(mgr.tokenKey, account.Id, expiresAt),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func clientSecretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimClient proves the caller holds the device: the first secret sent for
+// a client id is kept and later requests must repeat it. Client ids are not
+// secret, the secret is generated on the device and never leaves it otherwise.
+func (mgr *BookMgr) claimClient(clientId string, secret string) error {
+	if "" == clientId || strings.HasPrefix(clientId, accountOwnerPrefix) || minClientSecret > len(secret) {
+		return errors.New("Invalid parameter")
+	}
+	hash := clientSecretHash(secret)
+	claimed, err := mgr.store.SetClientSecret(clientId, hash)
+	if nil != err || claimed {
+		return err
+	}
+	stored, err := mgr.store.GetClientSecret(clientId)
+	if nil != err {
+		return err
+	}
+	if 1 != subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) {
+		return errors.New("Invalid client secret")
+	}
+	return nil
+}
+
+func (mgr *BookMgr) ClaimClient(body interface{}) error {
+	p, err := parseAccountReqBody(body)
+	if nil != err {
+		return err
+	}
+	return mgr.claimClient(p.ClientId, p.ClientSecret)
+}
+
+// linkClient attaches a device to an account and moves the data it
+// collected anonymously over to the account.
+func (mgr *BookMgr) linkClient(clientId string, secret string, accountId int64) error {
+	if "" == clientId {
+		return nil
+	}
+	err := mgr.claimClient(clientId, secret)
+	if nil != err {
+		return err
+	}
+	linked, err := mgr.store.GetClientAccount(clientId)
+	if nil != err {
+		return err
+	}
+	if linked == accountId {
+		return nil
+	}
+	if 0 < linked {
+		return errors.New("Client already linked to another account")
+	}
+	err = mgr.store.LinkClient(clientId, accountId)
+	if nil != err {
+		return err
+	}
+	return mgr.store.MoveOwnerData(clientId, accountOwner(accountId))
+}
+
+func (mgr *BookMgr) Register(body interface{}) (*AccountSession, error) {
+	p, err := parseAccountReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	if "" == p.Name || maxAccountNameSize < len(p.Name) || minPasswordLength > len(p.Password) {
+		return nil, errors.New("Invalid parameter")
+	}
+	existing, err := mgr.store.GetAccountByName(p.Name)
+	if nil != err {
+		return nil, err
+	}
+	if nil != existing {
+		return nil, errors.New("Account already exists")
+	}
+	if "" != p.ClientId {
+		err = mgr.claimClient(p.ClientId, p.ClientSecret)
+		if nil != err {
+			return nil, err
+		}
+		linked, err := mgr.store.GetClientAccount(p.ClientId)
+		if nil != err {
+			return nil, err
+		}
+		if 0 < linked {
+			return nil, errors.New("Client already linked to another account")
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(p.Password), bcrypt.DefaultCost)
+	if nil != err {
+		return nil, err
+	}
+	account := Account{Name: p.Name, PasswordHash: string(hash), CreatedAt: time.Now().Unix()}
+	err = mgr.store.AddAccount(&account)
+	if nil != err {
+		return nil, err
+	}
+
+	err = mgr.linkClient(p.ClientId, p.ClientSecret, account.Id)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.newSession(&account)
+}
+
+func (mgr *BookMgr) Login(body interface{}) (*AccountSession, error) {
+	p, err := parseAccountReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+
+	account, err := mgr.store.GetAccountByName(p.Name)
+	if nil != err {
+		return nil, err
+	}
+	if nil == account ||
+		nil != bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(p.Password)) {
+		return nil, errors.New("Invalid name or password")
+	}
+
+	err = mgr.linkClient(p.ClientId, p.ClientSecret, account.Id)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.newSession(account)
+}
+
+func (mgr *BookMgr) sessionAccount(token string) (*Account, error) {
+	accountId, err := verifyToken(mgr.tokenKey, token, time.Now())
+	if nil != err {
+		return nil, err
+	}
+	account, err := mgr.store.GetAccount(accountId)
+	if nil != err {
+		return nil, err
+	}
+	if nil == account {
+		return nil, errors.New("Invalid token")
+	}
+	return account, nil
+}
+
+func (mgr *BookMgr) LinkClient(body interface{}) (*AccountSession, error) {
+	p, err := parseAccountReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	if "" == p.ClientId {
+		return nil, errors.New("Invalid parameter")
+	}
+	account, err := mgr.sessionAccount(p.Token)
+	if nil != err {
+		return nil, err
+	}
+	err = mgr.linkClient(p.ClientId, p.ClientSecret, account.Id)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.newSession(account)
+}
+
+func (mgr *BookMgr) GetAccount(token string) (*AccountInfo, error) {
+	account, err := mgr.sessionAccount(token)
+	if nil != err {
+		return nil, err
+	}
+	clientIds, err := mgr.store.QueryAccountClients(account.Id)
+	if nil != err {
+		return nil, err
+	}
+	return &AccountInfo{Account: account, ClientIds: clientIds}, nil
+}
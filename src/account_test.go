@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func init() {
+	cfg.Account.TokenSecret = "test-token-secret"
+}
+
+func TestTokenSecretRequired(t *testing.T) {
+	old := cfg.Account.TokenSecret
+	defer func() { cfg.Account.TokenSecret = old }()
+	cfg.Account.TokenSecret = ""
+	if _, err := NewBookMgr(newTestBookStore(t), nil); nil == err {
+		t.Error("NewBookMgr without token secret: expected error")
+	}
+}
+
+func TestTokenSignVerify(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	token := signToken(key, 7, now.Unix()+60)
+	if id, err := verifyToken(key, token, now); nil != err || 7 != id {
+		t.Errorf("verifyToken: got %d %v", id, err)
+	}
+	if _, err := verifyToken([]byte("other"), token, now); nil == err {
+		t.Error("verifyToken(wrong key): expected error")
+	}
+	if _, err := verifyToken(key, token, now.Add(time.Minute)); nil == err {
+		t.Error("verifyToken(expired): expected error")
+	}
+	forged := signToken([]byte("other"), 8, now.Unix()+60)
+	if _, err := verifyToken(key, forged[:len(forged)-43]+token[len(token)-43:], now); nil == err {
+		t.Error("verifyToken(forged): expected error")
+	}
+	for _, bad := range []string{"", "x", "a.b.c", "!!.!!"} {
+		if _, err := verifyToken(key, bad, now); nil == err {
+			t.Errorf("verifyToken(%q): expected error", bad)
+		}
+	}
+}
+
+func TestAccountRegisterLogin(t *testing.T) {
+	setTestBookMgr(t)
+	var session AccountSession
+	body := `{"action":"register","body":{"name":"cat","password":"123456","client_id":"phone","client_secret":"phone-secret-0123"}}`
+	resp := doRequest(t, AccountProc, "POST", "/account", body, &session)
+	if 0 != resp.Code || "" == session.Token || 1 != len(session.Account.ClientIds) {
+		t.Fatalf("POST /account register: got %+v %+v", resp, session)
+	}
+
+	invalid := []string{
+		body,
+		`{"action":"register","body":{"name":"dog","password":"123"}}`,
+		`{"action":"login","body":{"name":"cat","password":"654321"}}`,
+		`{"action":"login","body":{"name":"nobody","password":"123456"}}`,
+		`{"action":"link","body":{"token":"x","client_id":"pad"}}`,
+		`{"action":"register","body":{"name":"dog","password":"123456","client_id":"tv"}}`,
+		`{"action":"login","body":{"name":"cat","password":"123456","client_id":"phone","client_secret":"wrong-secret-0123"}}`,
+		`{"action":"x","body":{}}`,
+	}
+	for _, body := range invalid {
+		if resp = doRequest(t, AccountProc, "POST", "/account", body, nil); -3 != resp.Code {
+			t.Errorf("POST /account %s: expected -3, got %+v", body, resp)
+		}
+	}
+
+	// A name already taken must not use up the claim of the device.
+	body = `{"action":"register","body":{"name":"cat","password":"123456","client_id":"pad","client_secret":"other-secret-0123"}}`
+	if resp = doRequest(t, AccountProc, "POST", "/account", body, nil); -3 != resp.Code {
+		t.Errorf("POST /account register taken name: expected -3, got %+v", resp)
+	}
+
+	body = `{"action":"login","body":{"name":"cat","password":"123456","client_id":"pad","client_secret":"pad-secret-012345"}}`
+	resp = doRequest(t, AccountProc, "POST", "/account", body, &session)
+	if 0 != resp.Code || 2 != len(session.Account.ClientIds) {
+		t.Fatalf("POST /account login: got %+v %+v", resp, session)
+	}
+
+	var account accountResp
+	resp = doRequest(t, AccountProc, "GET", "/account?token="+session.Token, "", &account)
+	if 0 != resp.Code || "cat" != account.Account.Name {
+		t.Errorf("GET /account: got %+v %+v", resp, account.Account)
+	}
+	if resp = doRequest(t, AccountProc, "GET", "/account?token=x", "", nil); -3 != resp.Code {
+		t.Errorf("GET /account bad token: expected -3, got %+v", resp)
+	}
+}
+
+func TestAccountDataFollowsAccount(t *testing.T) {
+	setTestBookMgr(t)
+	mgr.addShelfBook(map[string]string{"client_id": "phone", "book_id": "1"})
+	mgr.SaveReadingProgress(map[string]interface{}{"client_id": "phone", "book_id": "1", "native_id": 2, "updated_at": 100})
+	if err := mgr.ClaimClient(map[string]string{"client_id": "pad", "client_secret": "pad-secret-012345"}); nil != err {
+		t.Fatal(err)
+	}
+
+	session, err := mgr.Register(map[string]string{"name": "cat", "password": "123456",
+		"client_id": "phone", "client_secret": "phone-secret-0123"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = mgr.LinkClient(map[string]string{"token": session.Token, "client_id": "pad"}); nil == err {
+		t.Error("LinkClient without the client secret: expected error")
+	}
+	if _, err = mgr.LinkClient(map[string]string{"token": session.Token, "client_id": "pad",
+		"client_secret": "pad-secret-012345"}); nil != err {
+		t.Fatal(err)
+	}
+
+	// The anonymous shelf moved to the account, a linked client must send the token.
+	var shelf shelfResp
+	resp := doRequest(t, ShelfProc, "GET", "/shelf?client_id=pad", "", &shelf)
+	if 0 == resp.Code {
+		t.Errorf("GET /shelf linked client without token: got %+v", resp)
+	}
+	resp = doRequest(t, ShelfProc, "GET", "/shelf?token="+session.Token, "", &shelf)
+	if 0 != resp.Code || 1 != len(shelf.Books) || "1" != shelf.Books[0].Id {
+		t.Errorf("GET /shelf with token: got %+v %+v", resp, shelf.Books)
+	}
+	body := `{"action":"add","body":{"token":"` + session.Token + `","book_id":"2"}}`
+	resp = doRequest(t, ShelfProc, "POST", "/shelf", body, &shelf)
+	if 0 != resp.Code || 2 != len(shelf.Books) {
+		t.Errorf("POST /shelf with token: got %+v %+v", resp, shelf.Books)
+	}
+
+	progress, err := mgr.GetReadingProgress("", session.Token, "1")
+	if nil != err || nil == progress || 2 != progress.NativeId {
+		t.Errorf("GetReadingProgress linked client: got %+v %v", progress, err)
+	}
+
+	if _, err = mgr.addBookRead(map[string]string{"client_id": "phone", "book_id": "3"}); nil == err {
+		t.Error("addBookRead linked client without token: expected error")
+	}
+
+	// Reads from two devices of one account count once a day.
+	mgr.addBookRead(map[string]string{"token": session.Token, "book_id": "3"})
+	book, _ := mgr.addBookRead(map[string]string{"token": session.Token, "book_id": "3"})
+	if 21 != book.TotalReads {
+		t.Errorf("addBookRead across devices: expected 21, got %d", book.TotalReads)
+	}
+
+	if _, err = mgr.Register(map[string]string{"name": "dog", "password": "123456",
+		"client_id": "pad", "client_secret": "pad-secret-012345"}); nil == err {
+		t.Error("Register with a client of another account: expected error")
+	}
+}
+
+func TestHandlersRejectInvalidToken(t *testing.T) {
+	setTestBookMgr(t)
+	if resp := doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=reads&token=x", "", nil); -2 != resp.Code {
+		t.Errorf("GET /books bad token: expected -2, got %+v", resp)
+	}
+	if resp := doRequest(t, BookProc, "GET", "/book?a=detail&id=1&token=x", "", nil); -2 != resp.Code {
+		t.Errorf("GET /book bad token: expected -2, got %+v", resp)
+	}
+	body := `{"action":"add","key":"read","body":{"book_id":"1","token":"x"}}`
+	if resp := doRequest(t, BookProc, "POST", "/book", body, nil); -3 != resp.Code {
+		t.Errorf("POST /book bad token: expected -3, got %+v", resp)
+	}
+}
+
+func TestVotesAndReadsFollowAccount(t *testing.T) {
+	setTestBookMgr(t)
+	if resp := postBookVote(t, "add", "1", "phone", nil); 0 != resp.Code {
+		t.Fatalf("POST /book vote: got %+v", resp)
+	}
+	mgr.addBookRead(map[string]string{"client_id": "phone", "book_id": "3"})
+
+	session, err := mgr.Register(map[string]string{"name": "cat", "password": "123456",
+		"client_id": "phone", "client_secret": "phone-secret-0123"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	body := `{"action":"add","key":"vote","body":{"book_id":"1","token":"` + session.Token + `"}}`
+	if resp := doRequest(t, BookProc, "POST", "/book", body, nil); -3 != resp.Code {
+		t.Errorf("POST /book vote again after linking: expected -3, got %+v", resp)
+	}
+	book, err := mgr.addBookRead(map[string]string{"token": session.Token, "book_id": "3"})
+	if nil != err || 21 != book.TotalReads {
+		t.Errorf("addBookRead after linking: expected 21, got %+v %v", book, err)
+	}
+
+	// The vote keeps the client id it was cast with, the account can revoke it.
+	body = `{"action":"del","key":"vote","body":{"book_id":"1","token":"` + session.Token + `"}}`
+	if resp := doRequest(t, BookProc, "POST", "/book", body, nil); 0 != resp.Code {
+		t.Errorf("POST /book revoke vote after linking: got %+v", resp)
+	}
+	votes, _ := mgr.store.QueryBookVotes("1", 0, 10)
+	if 1 != len(votes) || "phone" != votes[0].ClientId || !votes[0].Revoked {
+		t.Errorf("votes after linking: got %+v", votes)
+	}
+}
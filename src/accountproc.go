@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+type accountResp struct {
+	Account *AccountInfo `json:"account"`
+}
+
+func accountGet(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	token := ""
+	if 0 < len(r.Form["token"]) {
+		token = r.Form["token"][0]
+	}
+	if "" == token {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+
+	account, err := mgr.GetAccount(token)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", accountResp{Account: account})
+}
+
+func operateAccount(p apiPostP) (interface{}, error) {
+	switch p.Action {
+	case "claim":
+		return nil, mgr.ClaimClient(p.Body)
+	case "register":
+		return mgr.Register(p.Body)
+	case "login":
+		return mgr.Login(p.Body)
+	case "link":
+		return mgr.LinkClient(p.Body)
+	}
+	return nil, errors.New("Invalid action")
+}
+
+func accountPost(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	var p apiPostP
+	err = json.Unmarshal(body, &p)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+
+	resp, err := operateAccount(p)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", resp)
+}
+
+func AccountProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		accountGet(w, r)
+	case "POST":
+		accountPost(w, r)
+	}
+}
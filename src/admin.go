@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	roleAdmin  = "admin"
+	roleEditor = "editor"
+
+	defaultAdminMaxSkew = 300
+)
+
+var (
+	errAdminUnauthenticated = errors.New("Authentication required")
+	errAdminForbidden       = errors.New("Permission denied")
+)
+
+// systemAdmin acts for changes the server makes on its own.
+var systemAdmin = &AdminKeyCfg{Name: "system", Role: roleAdmin}
+
+func (k *AdminKeyCfg) canSetList(clazz string) bool {
+	switch k.Role {
+	case roleAdmin:
+		return true
+	case roleEditor:
+		list := findRecommendList(clazz)
+		return nil != list && list.Editor
+	}
+	return false
+}
+
+func findAdminKey(name string) *AdminKeyCfg {
+	for i := range cfg.Admin.Keys {
+		if name == cfg.Admin.Keys[i].Name {
+			return &cfg.Admin.Keys[i]
+		}
+	}
+	return nil
+}
+
+func adminSignature(key string, method string, path string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticateAdmin accepts either a plain API key in X-Api-Key, or an
+// HMAC-SHA256 over method, path, timestamp and body sent as X-Admin-Name,
+// X-Admin-Timestamp and X-Admin-Signature.
+func authenticateAdmin(r *http.Request, body []byte, now time.Time) (*AdminKeyCfg, error) {
+	if apiKey := r.Header.Get("X-Api-Key"); "" != apiKey {
+		for i := range cfg.Admin.Keys {
+			key := &cfg.Admin.Keys[i]
+			if "" != key.Key && 1 == subtle.ConstantTimeCompare([]byte(apiKey), []byte(key.Key)) {
+				return key, nil
+			}
+		}
+		return nil, errAdminUnauthenticated
+	}
+
+	name := r.Header.Get("X-Admin-Name")
+	timestamp := r.Header.Get("X-Admin-Timestamp")
+	signature := r.Header.Get("X-Admin-Signature")
+	if "" == name || "" == timestamp || "" == signature {
+		return nil, errAdminUnauthenticated
+	}
+	key := findAdminKey(name)
+	if nil == key || "" == key.Key {
+		return nil, errAdminUnauthenticated
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if nil != err {
+		return nil, errAdminUnauthenticated
+	}
+	skew := now.Unix() - ts
+	if 0 > skew {
+		skew = -skew
+	}
+	if skew > int64(cacheTTL(cfg.Admin.MaxSkew, defaultAdminMaxSkew)/time.Second) {
+		return nil, errAdminUnauthenticated
+	}
+
+	expected := adminSignature(key.Key, r.Method, r.URL.Path, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errAdminUnauthenticated
+	}
+	return key, nil
+}
+
+func adminError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case errAdminUnauthenticated:
+		w.WriteHeader(http.StatusUnauthorized)
+		Response(w, -4, err.Error(), nil)
+	case errAdminForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		Response(w, -5, err.Error(), nil)
+	default:
+		return false
+	}
+	return true
+}
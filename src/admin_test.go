@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestAdminKeys() func() {
+	old := cfg.Admin
+	cfg.Admin = AdminCfg{Keys: []AdminKeyCfg{
+		{Name: "root", Key: "admin-key", Role: roleAdmin},
+		{Name: "editor", Key: "editor-key", Role: roleEditor},
+	}}
+	return func() {
+		cfg.Admin = old
+	}
+}
+
+func doAdminRequest(t *testing.T, handler http.HandlerFunc, target string, body string, apiKey string) testResp {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("X-Api-Key", apiKey)
+	return serveRequest(t, handler, r, nil)
+}
+
+func signedAdminRequest(target string, body string, name string, key string, ts int64) *http.Request {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts, 10)
+	r.Header.Set("X-Admin-Name", name)
+	r.Header.Set("X-Admin-Timestamp", timestamp)
+	r.Header.Set("X-Admin-Signature", adminSignature(key, "POST", r.URL.Path, timestamp, []byte(body)))
+	return r
+}
+
+func TestBooksPostRequiresAdmin(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	girl := `{"action":"set","body":{"clazz":"girlrecommend","books":[{"id":"3"}]}}`
+	director := `{"action":"set","body":{"clazz":"directorrecommend",` +
+		`"books":[{"id":"3","rwords":"好看","ruser":"橘猫"}]}}`
+
+	w := httptest.NewRecorder()
+	BookMgrsProc(w, httptest.NewRequest("POST", "/books", strings.NewReader(girl)))
+	if http.StatusUnauthorized != w.Code || !strings.Contains(w.Body.String(), `"code":-4`) {
+		t.Errorf("POST /books anonymous: got %d %s", w.Code, w.Body.String())
+	}
+	if resp := doAdminRequest(t, BookMgrsProc, "/books", girl, "wrong"); -4 != resp.Code {
+		t.Errorf("POST /books wrong key: expected -4, got %+v", resp)
+	}
+
+	// Editors may only change the director list.
+	if resp := doAdminRequest(t, BookMgrsProc, "/books", girl, "editor-key"); -5 != resp.Code {
+		t.Errorf("POST /books editor girlrecommend: expected -5, got %+v", resp)
+	}
+	if resp := doAdminRequest(t, BookMgrsProc, "/books", director, "editor-key"); 0 != resp.Code {
+		t.Errorf("POST /books editor directorrecommend: got %+v", resp)
+	}
+	if resp := doAdminRequest(t, BookMgrsProc, "/books", girl, "admin-key"); 0 != resp.Code {
+		t.Errorf("POST /books admin: got %+v", resp)
+	}
+}
+
+func TestBooksPostSignedAdmin(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	body := `{"action":"set","body":{"clazz":"girlrecommend","books":[{"id":"3"}]}}`
+	now := time.Now().Unix()
+
+	r := signedAdminRequest("/books", body, "root", "admin-key", now)
+	if resp := serveRequest(t, BookMgrsProc, r, nil); 0 != resp.Code {
+		t.Errorf("POST /books signed: got %+v", resp)
+	}
+
+	invalid := []*http.Request{
+		signedAdminRequest("/books", body, "root", "admin-key", now-3600),
+		signedAdminRequest("/books", body, "root", "editor-key", now),
+		signedAdminRequest("/books", body, "nobody", "admin-key", now),
+	}
+	tampered := signedAdminRequest("/books", body, "root", "admin-key", now)
+	tampered.Body = httptest.NewRequest("POST", "/books", strings.NewReader(body+" ")).Body
+	invalid = append(invalid, tampered)
+	for i, r := range invalid {
+		if resp := serveRequest(t, BookMgrsProc, r, nil); -4 != resp.Code {
+			t.Errorf("POST /books invalid signature %d: expected -4, got %+v", i, resp)
+		}
+	}
+}
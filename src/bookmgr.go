@@ -1,14 +1,14 @@
 package main
 
 import (
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"kkt.com/glog"
-	"strings"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 )
 
 type contentSpecP struct {
@@ -26,261 +26,200 @@ type BooksInfo struct {
 
 type BookMgr struct {
 	PageCount int
+	store     BookStore
+	cache     Cache
+	client    *http.Client
+	counters  *CounterAggregator
+	voteMutex sync.Mutex
+	tokenKey  []byte
+	scheduler *PeriodicTask
+	index     *SearchIndex
+	indexer   *PeriodicTask
+	pruner    *PeriodicTask
+
+	scheduleMutex sync.Mutex
 }
 
 const defaultClazz = "default"
 
-func NewBookMgr() (*BookMgr, error) {
+func NewBookMgr(store BookStore, cache Cache) (*BookMgr, error) {
+	if nil == store {
+		return nil, errors.New("Invalid book store")
+	}
+	if nil == cache {
+		cache = NewCache(&cfg.Cache)
+	}
 	var mgr BookMgr
 	mgr.PageCount = 20
+	mgr.store = store
+	mgr.cache = cache
+	mgr.client = &http.Client{Timeout: 10 * time.Second}
+	var err error
+	mgr.tokenKey, err = tokenKey()
+	if nil != err {
+		return nil, err
+	}
+	mgr.counters = NewCounterAggregator(store,
+		cacheTTL(cfg.Counter.FlushInterval, defaultFlushInterval), flushSize())
+	mgr.scheduler = NewPeriodicTask(cacheTTL(cfg.Schedule.Interval, defaultScheduleInterval),
+		func() error {
+			return mgr.RunSchedules(time.Now())
+		})
+
+	mgr.index = NewSearchIndex()
+	mgr.counters.OnFlush(mgr.index.AddCounters)
+	err = mgr.RebuildSearchIndex()
+	if nil != err {
+		glog.Error(err, ", search falls back to the book store")
+	}
+	mgr.indexer = NewPeriodicTask(cacheTTL(cfg.Search.RefreshInterval, defaultIndexRefresh),
+		mgr.RebuildSearchIndex)
+	mgr.pruner = NewPeriodicTask(cacheTTL(cfg.Counter.ReaderPruneInterval, defaultReaderPruneInterval),
+		func() error {
+			return mgr.PruneBookReaders(time.Now())
+		})
 	return &mgr, nil
 }
 
-func orderString(clazz string) (string, bool) {
-	var orderMap = map[string]string{
-		"recommend": "order by total_votes desc",
-		"votes":     "order by total_votes desc",
-		"reads":     "order by total_reads desc",
-		"searches":  "order by total_searches desc",
-		"chars":     "order by total_chars desc",
-		"traces":    "order by total_reads desc",
-		"score":     "order by score desc",
+func flushSize() int {
+	if 0 >= cfg.Counter.FlushSize {
+		return defaultFlushSize
 	}
-	if _, ok := orderMap[clazz]; ok {
-		return orderMap[clazz], true
-	}
-	return orderMap["score"], false
+	return cfg.Counter.FlushSize
 }
 
-func (mgr *BookMgr) sqlRecommendString(clazz string, gender string, finished bool, curPage int) string {
-	offset := curPage * mgr.PageCount
-	orderStr, ok := orderString(clazz)
-	sqlWhere := extraSqlWhereString(gender, finished)
-	if !ok {
-		if "" == sqlWhere {
-			sqlWhere += "where "
-		} else {
-			sqlWhere += " and "
-		}
-		sqlWhere += "class='" + clazz + "'"
-	}
-	sqlExec := fmt.Sprintf(
-		"select * from `books_table`%s %s limit %d offset %d",
-		sqlWhere, orderStr, mgr.PageCount, offset)
-	return sqlExec
-}
-
-func findClazzRecommendTableName(clazz string) string {
-	var tableMap = map[string]string{
-		"fprecommend":       "main_recommend_books",
-		"girlrecommend":     "girl_recommend_books",
-		"shelfrecommend":    "shelf_recommend_books",
-		"directorrecommend": "director_recommend_books",
-		"finishedrecommend": "finished_recommend_books",
-	}
-	return tableMap[clazz]
-}
-
-func (mgr *BookMgr) sqlClazzRecommendString(clazz string, gender string, finished bool) string {
-	tableName := findClazzRecommendTableName(clazz)
-	sqlWhere := extraSqlWhereString(gender, finished)
-	sqlExec := fmt.Sprintf("select * from `books_table` a join `%s` b on a.`id`=b.`book_id`%s", tableName, sqlWhere)
-	return sqlExec
-}
-
-func (mgr *BookMgr) sqlString(clazz string, gender string, finished bool, curPage int) string {
-	switch clazz {
-	case "fprecommend":
-		fallthrough
-	case "girlrecommend":
-		fallthrough
-	case "shelfrecommend":
-		fallthrough
-	case "directorrecommend":
-		fallthrough
-	case "finishedrecommend":
-		return mgr.sqlClazzRecommendString(clazz, gender, finished)
-	case "traces":
-		fallthrough
-	case "searches":
-		fallthrough
-	case "chars":
-		fallthrough
-	case "reads":
-		fallthrough
-	case "votes":
-		fallthrough
-	case "recommend":
-		fallthrough
-	default:
-		return mgr.sqlRecommendString(clazz, gender, finished, curPage)
-	}
-	return mgr.sqlRecommendString("recommend", gender, finished, curPage)
-}
-
-func (mgr *BookMgr) queryCommonRecommendBooks(sqlExec string) ([]*Book, error) {
-	var books = make([]*Book, 0)
-	err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-		var book Book
-		err := rows.Scan(&book.Id, &book.Name, &book.Abbreviation, &book.Author,
-			&book.Cover, &book.AuthorAvatar, &book.Finished, &book.TotalReads,
-			&book.TotalChars, &book.LastUpdateTime, &book.Class, &book.TotalSearches,
-			&book.TotalVotes, &book.LastChapterTitle, &book.LastChapterUrl,
-			&book.WithVIPChapter, &book.Gender, &book.Score, &book.Id)
-		books = append(books, &book)
-		return err
-	})
+func (mgr *BookMgr) FlushCounters() error {
+	return mgr.counters.Flush()
+}
 
-	if nil != err {
-		return books, err
-	}
+func (mgr *BookMgr) CounterStats() CounterStats {
+	return mgr.counters.Stats()
+}
 
-	return books, nil
+func (mgr *BookMgr) Close() {
+	mgr.pruner.Close()
+	mgr.indexer.Close()
+	mgr.scheduler.Close()
+	mgr.counters.Close()
 }
 
-func (mgr *BookMgr) queryDirectorRecommendBooks(sqlExec string) ([]*Book, error) {
-	var books = make([]*Book, 0)
-	err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-		var book Book
-		err := rows.Scan(&book.Id, &book.Name, &book.Abbreviation, &book.Author,
-			&book.Cover, &book.AuthorAvatar, &book.Finished, &book.TotalReads,
-			&book.TotalChars, &book.LastUpdateTime, &book.Class, &book.TotalSearches,
-			&book.TotalVotes, &book.LastChapterTitle, &book.LastChapterUrl,
-			&book.WithVIPChapter, &book.Gender, &book.Score, &book.Id,
-			&book.RWords, &book.RUser)
-		books = append(books, &book)
-		return err
-	})
+func (mgr *BookMgr) applyPendingCounters(book *Book) *Book {
+	pending := mgr.counters.Pending(book.Id)
+	book.TotalReads += pending.Reads
+	book.TotalSearches += pending.Searches
+	book.TotalVotes += pending.Votes
+	return book
+}
 
-	if nil != err {
-		return books, err
+func (mgr *BookMgr) getBook(id string) (*Book, error) {
+	book, err := mgr.store.GetBook(id)
+	if nil != err || nil == book {
+		return book, err
 	}
+	return mgr.applyPendingCounters(book), nil
+}
 
-	return books, nil
+func listCachePrefix(clazz string) string {
+	return fmt.Sprintf("books:l:%s:", clazz)
 }
 
-func (mgr *BookMgr) queryBooks(sqlExec string) ([]*Book, error) {
-	var books = make([]*Book, 0)
-	err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-		var book Book
-		err := rows.Scan(&book.Id, &book.Name, &book.Abbreviation, &book.Author,
-			&book.Cover, &book.AuthorAvatar, &book.Finished, &book.TotalReads,
-			&book.TotalChars, &book.LastUpdateTime, &book.Class, &book.TotalSearches,
-			&book.TotalVotes, &book.LastChapterTitle, &book.LastChapterUrl,
-			&book.WithVIPChapter, &book.Gender, &book.Score)
-		books = append(books, &book)
-		return err
-	})
+func listCacheKey(clazz string, gender string, finished bool, curPage int) string {
+	return fmt.Sprintf("%s%s:%t:%d", listCachePrefix(clazz), gender, finished, curPage)
+}
 
-	if nil != err {
-		return books, err
+func infoCacheKey(gender string, finished bool) string {
+	return fmt.Sprintf("books:c:%s:%t", gender, finished)
+}
+
+const searchCachePrefix = "books:s:"
+
+func searchCacheKey(key string, curPage int) string {
+	return fmt.Sprintf("%s%d:%s", searchCachePrefix, curPage, key)
+}
+
+func orderString(clazz string) (string, bool) {
+	var orderMap = map[string]string{
+		"recommend": orderByVotes,
+		"votes":     orderByVotes,
+		"reads":     orderByReads,
+		"searches":  orderBySearches,
+		"chars":     orderByChars,
+		"traces":    orderByReads,
+		"score":     orderByScore,
+	}
+	if _, ok := orderMap[clazz]; ok {
+		return orderMap[clazz], true
 	}
+	return orderMap["score"], false
+}
 
-	return books, nil
+func (mgr *BookMgr) queryRecommendBooks(clazz string, gender string, finished bool, curPage int) ([]*Book, error) {
+	order, ok := orderString(clazz)
+	filter := BookFilter{Gender: gender, Finished: finished}
+	if !ok {
+		filter.Clazz = clazz
+	}
+	return mgr.store.QueryBooks(filter, order, curPage*mgr.PageCount, mgr.PageCount)
 }
 
-func (mgr *BookMgr) queryBooksList(clazz string, sqlExec string) ([]*Book, error) {
-	switch clazz {
-	case "fprecommend":
-		fallthrough
-	case "girlrecommend":
-		fallthrough
-	case "shelfrecommend":
-		fallthrough
-	case "finishedrecommend":
-		return mgr.queryCommonRecommendBooks(sqlExec)
-	case "directorrecommend":
-		return mgr.queryDirectorRecommendBooks(sqlExec)
-	case "traces":
-		fallthrough
-	case "searches":
-		fallthrough
-	case "chars":
-		fallthrough
-	case "reads":
-		fallthrough
-	case "votes":
-		fallthrough
-	case "recommend":
-		fallthrough
-	default:
-		return mgr.queryBooks(sqlExec)
-	}
-	return mgr.queryBooks(sqlExec)
-}
-
-func extraSqlWhereString(gender string, finished bool) string {
-	sqlStr := ""
-	if gender == "girl" || finished {
-		sqlStr += " where "
-	}
-	if gender == "girl" {
-		sqlStr += "gender='girl'"
-	}
-	if gender == "girl" && finished {
-		sqlStr += " and "
-	}
-	if finished {
-		sqlStr += "finished=1"
-	}
-	return sqlStr
+func (mgr *BookMgr) queryBooksList(clazz string, gender string, finished bool, curPage int) ([]*Book, error) {
+	list := findRecommendList(clazz)
+	if nil != list {
+		filter := BookFilter{Gender: gender, Finished: finished}
+		if "" != list.Gender {
+			filter.Gender = list.Gender
+		}
+		return mgr.store.QueryRecommendBooks(list.Table, list.Notes, filter)
+	}
+
+	return mgr.queryRecommendBooks(clazz, gender, finished, curPage)
 }
 
 func (mgr *BookMgr) QueryBooksList(clazz string, gender string, finished bool, curPage int) ([]*Book, error) {
 	if curPage < 0 {
 		curPage = 0
 	}
-	sqlExec := mgr.sqlString(clazz, gender, finished, curPage)
 
-	return mgr.queryBooksList(clazz, sqlExec)
+	key := listCacheKey(clazz, gender, finished, curPage)
+	var books []*Book
+	if cacheGetJSON(mgr.cache, key, &books) {
+		return books, nil
+	}
+
+	books, err := mgr.queryBooksList(clazz, gender, finished, curPage)
+	if nil != err {
+		return books, err
+	}
+	cacheSetJSON(mgr.cache, key, books, cacheTTL(cfg.Cache.ListTTL, defaultListTTL))
+	return books, nil
 }
 
 func (mgr *BookMgr) QueryBooksInfo(clazz string, gender string, finished bool) (*BooksInfo, error) {
-	sqlExec := "select count(*) from `books_table`"
-	sqlWhere := extraSqlWhereString(gender, finished)
-	sqlExec += sqlWhere
-
+	key := infoCacheKey(gender, finished)
 	var info BooksInfo
-	err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-		err := rows.Scan(&info.Count)
-		return err
-	})
+	if cacheGetJSON(mgr.cache, key, &info) {
+		info.ContentSpec = cfg.ContentSpec
+		return &info, nil
+	}
 
+	filter := BookFilter{Gender: gender, Finished: finished}
+	var err error
+	info.Count, err = mgr.store.CountBooks(filter)
 	if nil != err {
 		return nil, err
 	}
 
-	sqlExec = "select distinct class from `books_table`" + sqlWhere
-	info.Clazzs = make([]string, 0)
-
-	err = DBQuery(sqlExec, func(rows *sql.Rows) error {
-		bytes := make([]byte, 128)
-		err := rows.Scan(&bytes)
-		if nil == err && 0 != len(bytes) {
-			info.Clazzs = append(info.Clazzs, string(bytes))
-		}
-		return err
-	})
-
+	info.Clazzs, err = mgr.store.QueryClazzs(filter)
 	if nil != err {
 		return nil, err
 	}
 
-	sqlExec = fmt.Sprintf("select word from `search_words_table` order by count limit 20")
-	info.HotWords = make([]string, 0)
-	err = DBQuery(sqlExec, func(rows *sql.Rows) error {
-		word := ""
-		err := rows.Scan(&word)
-		if nil == err {
-			info.HotWords = append(info.HotWords, word)
-		}
-		return err
-	})
-
-	if 0 == len(info.HotWords) {
+	info.HotWords, err = mgr.store.QueryHotWords(20)
+	if nil != err || 0 == len(info.HotWords) {
 		info.HotWords = []string{"唐家三少", "修真", "武侠仙侠"}
 	}
 	info.Pages = info.Count/mgr.PageCount + 1
+	cacheSetJSON(mgr.cache, key, &info, cacheTTL(cfg.Cache.InfoTTL, defaultInfoTTL))
 	info.ContentSpec = cfg.ContentSpec
 
 	return &info, nil
@@ -293,190 +232,330 @@ type recommendBook struct {
 }
 
 type recommendP struct {
-	Clazz string          `json:"clazz"`
-	Books []recommendBook `json:"books"`
+	Clazz     string          `json:"clazz"`
+	Books     []recommendBook `json:"books"`
+	PublishAt int64           `json:"publish_at"`
+	ExpireAt  int64           `json:"expire_at"`
 }
 
-func sqlFromRecommendParameter(p recommendP, director bool) (string, error) {
-	var valueStr = ""
-	var count = 0
-
+func (p *recommendP) validate() bool {
+	list := findRecommendList(p.Clazz)
+	if nil == list {
+		return false
+	}
+	if 0 < list.MaxSize && list.MaxSize < len(uniqueRecommendBooks(p.Books)) {
+		return false
+	}
+	if !list.Notes {
+		return true
+	}
 	for _, book := range p.Books {
-		if 0 < count {
-			valueStr += ","
-		}
-		count += 1
-		valueStr += "("
-		valueStr += fmt.Sprintf("'%s'", book.Id)
-		if director {
-			if "" == book.RWords || "" == book.RUser {
-				return "", errors.New("Invalid parameter")
-			}
-			valueStr += fmt.Sprintf(",'%s'", book.RWords)
-			valueStr += fmt.Sprintf(",'%s'", book.RUser)
+		if "" == book.RWords || "" == book.RUser {
+			return false
 		}
-		valueStr += ")"
 	}
+	return true
+}
 
-	var sqlExec = ""
-	tableName := findClazzRecommendTableName(p.Clazz)
-	if director {
-		sqlExec = fmt.Sprintf("insert into `%s` (book_id, rwords, ruser) values %s", tableName, valueStr)
-	} else {
-		sqlExec = fmt.Sprintf("insert into `%s` (book_id) values %s", tableName, valueStr)
+func (mgr *BookMgr) SetBooks(admin *AdminKeyCfg, key string, body interface{}) (*RecommendVersion, *RecommendSchedule, error) {
+	jsonStr, err := json.Marshal(body)
+	if nil != err {
+		return nil, nil, err
 	}
 
-	return sqlExec, nil
+	var p recommendP
+	err = json.Unmarshal(jsonStr, &p)
+	if nil != err {
+		return nil, nil, err
+	}
+	if !p.validate() {
+		return nil, nil, errors.New("Invalid parameter")
+	}
+	if !admin.canSetList(p.Clazz) {
+		return nil, nil, errAdminForbidden
+	}
+	err = mgr.checkListGender(&p)
+	if nil != err {
+		return nil, nil, err
+	}
+	return mgr.scheduleBooks(admin, &p)
 }
 
-func (mgr *BookMgr) sqlClazzRecommendSetString(p recommendP) (string, error) {
-	switch p.Clazz {
-	case "directorrecommend":
-		return sqlFromRecommendParameter(p, true)
-	default:
-		return sqlFromRecommendParameter(p, false)
+func (mgr *BookMgr) checkListGender(p *recommendP) error {
+	list := findRecommendList(p.Clazz)
+	if "" == list.Gender {
+		return nil
+	}
+	for _, b := range p.Books {
+		book, err := mgr.store.GetBook(b.Id)
+		if nil != err {
+			return err
+		}
+		if nil == book || list.Gender != book.Gender {
+			return errors.New("Book " + b.Id + " is not a " + list.Gender + " book")
+		}
 	}
+	return nil
 }
 
-func (mgr *BookMgr) SetBooks(key string, body interface{}) error {
-	jsonStr, err := json.Marshal(body)
+func (mgr *BookMgr) GetBookChapters(bookId string, afterNativeId int, offset int, limit int) ([]*Chapter, int, *Chapter, error) {
+	if 0 > offset {
+		offset = 0
+	}
+	chapters, err := mgr.store.QueryBookChapters(bookId, afterNativeId, offset, limit)
 	if nil != err {
-		return err
+		return make([]*Chapter, 0), -1, nil, err
 	}
-
-	var p recommendP
-	err = json.Unmarshal(jsonStr, &p)
+	total, err := mgr.store.CountBookChapters(bookId, afterNativeId)
 	if nil != err {
-		return err
+		return chapters, -1, nil, err
 	}
+	latest, err := mgr.store.GetLatestBookChapter(bookId)
+	if nil != err {
+		return chapters, total, nil, err
+	}
+	return chapters, total, latest, nil
+}
+
+const readingCharsPerMinute = 500
 
-	tableName := findClazzRecommendTableName(p.Clazz)
-	sqlReset := fmt.Sprintf("truncate table %s", tableName)
-	err = DBExec(sqlReset)
+type BookDetail struct {
+	*Book
+	TotalOpens     int      `json:"total_opens"`
+	ReadingMinutes int      `json:"reading_minutes"`
+	ChapterCount   int      `json:"chapter_count"`
+	LatestChapter  *Chapter `json:"latest_chapter"`
+	RecommendLists []string `json:"recommend_lists"`
+}
+
+func (mgr *BookMgr) GetBookDetail(bookId string) (*BookDetail, error) {
+	book, err := mgr.getBook(bookId)
 	if nil != err {
-		return err
+		return nil, err
+	}
+	if nil == book {
+		return nil, errors.New("Invalid parameter")
 	}
 
-	sqlInsert, err := mgr.sqlClazzRecommendSetString(p)
+	detail := BookDetail{Book: book}
+	detail.TotalOpens, err = mgr.store.GetBookOpens(bookId)
+	if nil != err {
+		return nil, err
+	}
+	detail.TotalOpens += mgr.counters.Pending(bookId).Opens
+	detail.ReadingMinutes = (book.TotalChars + readingCharsPerMinute - 1) / readingCharsPerMinute
+	detail.ChapterCount, err = mgr.store.CountBookChapters(bookId, -1)
+	if nil != err {
+		return nil, err
+	}
+	detail.LatestChapter, err = mgr.store.GetLatestBookChapter(bookId)
 	if nil != err {
-		return err
+		return nil, err
+	}
+
+	detail.RecommendLists = make([]string, 0)
+	for _, list := range recommendLists() {
+		ok, err := mgr.store.IsRecommendBook(list.Table, bookId)
+		if nil != err {
+			return nil, err
+		}
+		if ok {
+			detail.RecommendLists = append(detail.RecommendLists, list.Name)
+		}
+	}
+	sort.Strings(detail.RecommendLists)
+	return &detail, nil
+}
+
+func (mgr *BookMgr) contentExpired(stored *StoredChapterContent, chapter *Chapter, recent bool) bool {
+	age := time.Since(stored.FetchedAt)
+	if chapter.Vip && age > cacheTTL(cfg.ContentCache.VipRefresh, defaultVipRefresh) {
+		return true
+	}
+	if recent && age > cacheTTL(cfg.ContentCache.RecentRefresh, defaultRecentRefresh) {
+		return true
 	}
-	return DBExec(sqlInsert)
+	return false
 }
 
-func (mgr *BookMgr) GetBookChapters(name string, author string) ([]*Chapter, error) {
-	tableName := sha256.Sum256([]byte(name + author))
-	sqlExec := fmt.Sprintf("select * from `%s`", hex.EncodeToString(tableName[0:]))
+func (mgr *BookMgr) fetchChapterContent(book *Book, chapter *Chapter) (*StoredChapterContent, error) {
+	spec := findContentSpec(cfg.ContentSpec, chapter.Url)
+	if nil == spec {
+		spec = findContentSpec(cfg.ContentSpec, book.LastChapterUrl)
+	}
+	if nil == spec {
+		return nil, errors.New("Unknown content source")
+	}
 
-	var chapters = make([]*Chapter, 0)
-	err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-		var chapter Chapter
-		err := rows.Scan(&chapter.NativeId, &chapter.Id, &chapter.Title, &chapter.Url, &chapter.Vip)
-		chapters = append(chapters, &chapter)
-		return err
-	})
+	page, err := fetchContentPage(mgr.client, chapterContentUrl(spec, chapter.Url), spec.CharSet)
 	if nil != err {
-		return make([]*Chapter, 0), err
+		return nil, err
+	}
+	paragraphs, err := extractContent(page, spec)
+	if nil != err {
+		return nil, err
 	}
-	return chapters, nil
-}
 
-type searchKeyP struct {
-	word  string
-	count int
+	return NewStoredChapterContent(book.Id, chapter.Id, spec.Host, paragraphs), nil
 }
 
-func (mgr *BookMgr) updateSearches(books []*Book, key string) {
-	sqlExec := fmt.Sprintf("update `books_table` set total_searches = case id ")
-	ids := ""
-	for i, book := range books {
-		book.TotalSearches += 1
-		sqlExec += fmt.Sprintf("when '%s' then '%d' ", book.Id, book.TotalSearches)
-		if 0 < i {
-			ids += ","
+func (mgr *BookMgr) GetChapterContent(bookId string, chapterId string) (*ChapterContent, error) {
+	book, err := mgr.store.GetBook(bookId)
+	if nil != err {
+		return nil, err
+	}
+	if nil == book {
+		return nil, errors.New("Invalid parameter")
+	}
+
+	chapters, err := mgr.store.GetBookChapters(book.Id)
+	if nil != err {
+		return nil, err
+	}
+	var chapter *Chapter
+	recent := false
+	for i, c := range chapters {
+		if c.Id == chapterId {
+			chapter = c
+			recent = len(chapters)-i <= recentChapters()
+			break
 		}
-		ids += fmt.Sprintf("'%s'", book.Id)
 	}
-	sqlExec += fmt.Sprintf("end where id in (%s)", ids)
-	err := DBExec(sqlExec)
+	if nil == chapter {
+		return nil, errors.New("Invalid parameter")
+	}
+
+	stored, err := mgr.store.GetChapterContent(book.Id, chapterId)
 	if nil != err {
-		glog.Error("Error: fail to update searches")
+		glog.Warning(err)
+		stored = nil
+	}
+	if nil != stored && !stored.Verify() {
+		glog.Warning("Chapter content checksum mismatch: ", bookId, " ", chapterId)
+		stored = nil
 	}
 
-	p := searchKeyP{word: key, count: 0}
-	sqlExec = fmt.Sprintf("select * from `search_words_table` where word='%s'", key)
-	err = DBQuery(sqlExec, func(rows *sql.Rows) error {
-		err := rows.Scan(&p.word, &p.count)
-		return err
-	})
+	if nil == stored || mgr.contentExpired(stored, chapter, recent) {
+		fetched, err := mgr.fetchChapterContent(book, chapter)
+		if nil != err {
+			if nil == stored {
+				return nil, err
+			}
+			glog.Warning(err, ", serve stored chapter content")
+		} else {
+			stored = fetched
+			err = mgr.store.SaveChapterContent(stored)
+			if nil != err {
+				glog.Error(err)
+			}
+		}
+	}
 
-	p.count += 1
-	sqlExec = fmt.Sprintf("insert into `search_words_table` values ('%s', %d)"+
-		" on duplicate key update count=%d", p.word, p.count, p.count)
-	err = DBExec(sqlExec)
-	if nil != err {
-		glog.Error("Error: fail to update search words")
+	return &ChapterContent{
+		BookId:     bookId,
+		ChapterId:  chapterId,
+		Title:      chapter.Title,
+		Vip:        chapter.Vip,
+		Source:     stored.Host,
+		FetchedAt:  stored.FetchedAt.Unix(),
+		Paragraphs: stored.Paragraphs,
+	}, nil
+}
+
+func (mgr *BookMgr) updateSearches(books []*Book, key string) {
+	for _, book := range books {
+		mgr.counters.Add(book.Id, BookCounters{Searches: 1})
 	}
+	mgr.counters.AddSearchWord(key)
+}
+
+type searchResult struct {
+	Books  []*Book       `json:"books"`
+	Count  int           `json:"count"`
+	Facets *SearchFacets `json:"facets"`
 }
 
-func (mgr *BookMgr) SearchBooks(clazz string, curPage int) ([]*Book, int, error) {
-	sqlWhere := ""
-	key := ""
-	cs := strings.Split(clazz, "")
-	for _, c := range cs {
-		key += fmt.Sprintf("%%%s", c)
+// searchMatches returns every book matching key in relevance order, from the
+// search index or, until it is built, from the book store.
+func (mgr *BookMgr) searchMatches(key string) ([]*Book, error) {
+	if mgr.index.Ready() {
+		return mgr.index.Search(key), nil
+	}
+
+	count, err := mgr.store.CountSearchBooks(key)
+	if nil != err {
+		return nil, err
+	}
+	if count > maxFallbackResults {
+		count = maxFallbackResults
 	}
-	if "" != clazz {
-		key += fmt.Sprintf("%%")
-		sqlWhere = " where author like '" + key +
-			"' or name like '" + key +
-			"' or class like '" + key + "'"
+	if 0 == count {
+		return make([]*Book, 0), nil
 	}
+	return mgr.store.SearchBooks(key, 0, count)
+}
+
+func (mgr *BookMgr) SearchBooks(clazz string, filter *SearchFilter, curPage int) ([]*Book, int, *SearchFacets, error) {
 	if curPage < 0 {
 		curPage = 0
 	}
+	if nil == filter {
+		filter = &SearchFilter{Sort: sortRelevance}
+	}
 
-	count := -1
-	if 0 == curPage {
-		sqlExec := fmt.Sprintf("select count(*) from `books_table`%s order by score desc", sqlWhere)
-		err := DBQuery(sqlExec, func(rows *sql.Rows) error {
-			err := rows.Scan(&count)
-			return err
-		})
-		if nil != err {
-			return make([]*Book, 0), -1, err
-		}
+	key := searchCacheKey(clazz+":"+filter.cacheKey(), curPage)
+	var result searchResult
+	if cacheGetJSON(mgr.cache, key, &result) {
+		mgr.updateSearches(result.Books, clazz)
+		return result.Books, result.Count, result.Facets, nil
 	}
 
-	offset := curPage * mgr.PageCount
-	sqlExec := fmt.Sprintf("select * from `books_table`%s order by score desc limit %d offset %d",
-		sqlWhere, mgr.PageCount, offset)
-	books, err := mgr.queryBooks(sqlExec)
+	matches, err := mgr.searchMatches(clazz)
 	if nil != err {
-		return make([]*Book, 0), count, err
+		return make([]*Book, 0), -1, nil, err
+	}
+	for _, book := range matches {
+		mgr.applyPendingCounters(book)
 	}
 
-	go mgr.updateSearches(books, clazz)
+	facets := filter.facets(matches)
+	books := filter.apply(matches)
+	count := len(books)
 
-	return books, count, nil
+	start := curPage * mgr.PageCount
+	if start > count {
+		start = count
+	}
+	end := start + mgr.PageCount
+	if end > count {
+		end = count
+	}
+	books = books[start:end]
+
+	cacheSetJSON(mgr.cache, key, &searchResult{Books: books, Count: count, Facets: facets},
+		cacheTTL(cfg.Cache.SearchTTL, defaultSearchTTL))
+	mgr.updateSearches(books, clazz)
+
+	return books, count, facets, nil
 }
 
 type bookReqBodyBaseP struct {
 	BookId   string `json:"book_id"`
 	ClientId string `json:"client_id"`
+	Token    string `json:"token"`
 }
 
 func (p *bookReqBodyBaseP) validate() bool {
 	if "" == p.BookId {
 		return false
 	}
-	if "" == p.ClientId {
+	if "" == p.ClientId && "" == p.Token {
 		return false
 	}
 	return true
 }
 
-func (mgr *BookMgr) addBookRead(body interface{}) (*Book, error) {
+func parseBookReqBody(body interface{}) (*bookReqBodyBaseP, error) {
 	bodyJSON, err := json.Marshal(body)
 	if nil != err {
 		return nil, err
@@ -489,23 +568,57 @@ func (mgr *BookMgr) addBookRead(body interface{}) (*Book, error) {
 	if !p.validate() {
 		return nil, errors.New("Invalid parameter")
 	}
+	return &p, nil
+}
 
-	sqlExec := fmt.Sprintf("select * from `books_table` where id='%s'", p.BookId)
-	books, err := mgr.queryBooks(sqlExec)
+// parseOwnerReqBody parses a book request and replaces its client id with
+// the owner the request acts for.
+func (mgr *BookMgr) parseOwnerReqBody(body interface{}) (*bookReqBodyBaseP, error) {
+	p, err := parseBookReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	p.ClientId, err = mgr.ownerId(p.ClientId, p.Token)
 	if nil != err {
 		return nil, err
 	}
-	if 0 == len(books) {
+	return p, nil
+}
+
+func (mgr *BookMgr) addBookRead(body interface{}) (*Book, error) {
+	p, err := mgr.parseOwnerReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+
+	book, err := mgr.store.GetBook(p.BookId)
+	if nil != err {
+		return nil, err
+	}
+	if nil == book {
 		return nil, errors.New("Invalid parameter")
 	}
+	return mgr.recordBookRead(book, p.ClientId)
+}
 
-	books[0].TotalReads += 1
-	sqlExec = fmt.Sprintf("update `books_table` set total_reads='%d' where id='%s'",
-		books[0].TotalReads, p.BookId)
-	err = DBExec(sqlExec)
+func (mgr *BookMgr) PruneBookReaders(now time.Time) error {
+	return mgr.store.DeleteBookReaders(voteDay(now))
+}
+
+func (mgr *BookMgr) recordBookRead(book *Book, clientId string) (*Book, error) {
+	delta := BookCounters{Opens: 1}
+	isNew, err := mgr.store.AddBookReader(book.Id, clientId, voteDay(time.Now()))
 	if nil != err {
 		return nil, err
 	}
+	if isNew {
+		delta.Reads = 1
+	}
+	mgr.counters.Add(book.Id, delta)
 
-	return books[0], nil
+	err = mgr.markShelfBookOpened(clientId, book.Id)
+	if nil != err {
+		glog.Warning(err)
+	}
+	return mgr.applyPendingCounters(book), nil
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBookStore(t *testing.T) *MemBookStore {
+	store, err := NewMemBookStore()
+	if nil != err {
+		t.Fatal(err)
+	}
+	store.AddBook(&Book{Id: "1", Name: "斗破苍穹", Author: "天蚕土豆", Class: "玄幻",
+		Gender: "boy", TotalReads: 10, TotalVotes: 3, TotalChars: 5000000, Score: 90})
+	store.AddBook(&Book{Id: "2", Name: "凡人修仙传", Author: "忘语", Class: "修真",
+		Gender: "boy", Finished: true, TotalReads: 30, TotalVotes: 1, TotalChars: 7000000, Score: 95})
+	store.AddBook(&Book{Id: "3", Name: "花千骨", Author: "Fresh果果", Class: "仙侠",
+		Gender: "girl", Finished: true, TotalReads: 20, TotalVotes: 5, TotalChars: 800000, Score: 80})
+	store.AddBookChapters("1", []*Chapter{
+		{NativeId: 1, Id: "c1", Title: "第一章", Url: "http://59xs.com/1.html"},
+		{NativeId: 2, Id: "c2", Title: "第二章", Url: "http://59xs.com/2.html", Vip: true},
+	})
+	return store
+}
+
+func newTestBookMgr(t *testing.T) (*BookMgr, *MemBookStore) {
+	store := newTestBookStore(t)
+	m, err := NewBookMgr(store, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return m, store
+}
+
+func bookIds(books []*Book) []string {
+	ids := make([]string, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.Id)
+	}
+	return ids
+}
+
+func equalIds(books []*Book, ids ...string) bool {
+	got := bookIds(books)
+	if len(got) != len(ids) {
+		return false
+	}
+	for i := range got {
+		if got[i] != ids[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewBookMgrRequiresStore(t *testing.T) {
+	if _, err := NewBookMgr(nil, nil); nil == err {
+		t.Error("NewBookMgr(nil, nil): expected error")
+	}
+}
+
+func TestQueryBooksListOrder(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	for clazz, expect := range map[string][]string{
+		"reads":   {"2", "3", "1"},
+		"votes":   {"3", "1", "2"},
+		"score":   {"2", "1", "3"},
+		"chars":   {"2", "1", "3"},
+		"修真":      {"2"},
+		"nothing": {},
+	} {
+		books, err := m.QueryBooksList(clazz, "default", false, 0)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !equalIds(books, expect...) {
+			t.Errorf("QueryBooksList(%q): expected %v, got %v", clazz, expect, bookIds(books))
+		}
+	}
+
+	books, _ := m.QueryBooksList("reads", "girl", true, 0)
+	if !equalIds(books, "3") {
+		t.Errorf("QueryBooksList(girl, finished): got %v", bookIds(books))
+	}
+}
+
+func TestSetBooksRecommend(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	_, _, err := m.SetBooks(systemAdmin, "", map[string]interface{}{
+		"clazz": "fprecommend",
+		"books": []map[string]string{{"id": "3"}, {"id": "1"}},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	books, err := m.QueryBooksList("fprecommend", "default", false, 0)
+	if nil != err || !equalIds(books, "3", "1") {
+		t.Errorf("fprecommend: got %v, %v", bookIds(books), err)
+	}
+
+	_, _, err = m.SetBooks(systemAdmin, "", map[string]interface{}{
+		"clazz": "directorrecommend",
+		"books": []map[string]string{{"id": "2"}},
+	})
+	if nil == err {
+		t.Error("directorrecommend without rwords: expected error")
+	}
+
+	_, _, err = m.SetBooks(systemAdmin, "", map[string]interface{}{
+		"clazz": "directorrecommend",
+		"books": []map[string]string{{"id": "2", "rwords": "好看", "ruser": "编辑"}},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	books, _ = m.QueryBooksList("directorrecommend", "default", false, 0)
+	if !equalIds(books, "2") || "好看" != books[0].RWords || "编辑" != books[0].RUser {
+		t.Errorf("directorrecommend: got %+v", books)
+	}
+
+	if _, _, err := m.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "unknown"}); nil == err {
+		t.Error("unknown list: expected error")
+	}
+}
+
+func TestQueryBooksInfo(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	info, err := m.QueryBooksInfo("", "girl", false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != info.Count || 1 != info.Pages || 1 != len(info.Clazzs) || "仙侠" != info.Clazzs[0] {
+		t.Errorf("QueryBooksInfo: got %+v", info)
+	}
+	if 0 == len(info.HotWords) {
+		t.Error("QueryBooksInfo: expected default hot words")
+	}
+}
+
+func TestSearchBooks(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	books, count, _, err := m.SearchBooks("斗苍", nil, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != count || !equalIds(books, "1") {
+		t.Errorf("SearchBooks: got %v, %d", bookIds(books), count)
+	}
+	m.FlushCounters()
+	if n, _ := store.GetSearchWordCount("斗苍"); 0 == n {
+		t.Error("updateSearches: search word not counted")
+	}
+}
+
+func TestAddBookRead(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	book, err := m.addBookRead(map[string]string{"book_id": "1", "client_id": "c"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 11 != book.TotalReads {
+		t.Errorf("addBookRead: expected 11, got %d", book.TotalReads)
+	}
+	m.FlushCounters()
+	if b, _ := store.GetBook("1"); 11 != b.TotalReads {
+		t.Errorf("addBookRead: store has %d", b.TotalReads)
+	}
+	if _, err := m.addBookRead(map[string]string{"book_id": "404", "client_id": "c"}); nil == err {
+		t.Error("addBookRead(unknown): expected error")
+	}
+	if _, err := m.addBookRead(map[string]string{"book_id": "1"}); nil == err {
+		t.Error("addBookRead(no client): expected error")
+	}
+}
+
+func TestAddBookReadDedupe(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	for _, client := range []string{"a", "a", "b", "a"} {
+		if _, err := m.addBookRead(map[string]string{"book_id": "1", "client_id": client}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	m.FlushCounters()
+	if b, _ := store.GetBook("1"); 12 != b.TotalReads {
+		t.Errorf("dedupe reads: expected 12, got %d", b.TotalReads)
+	}
+	if opens, _ := store.GetBookOpens("1"); 4 != opens {
+		t.Errorf("dedupe reads: expected 4 opens, got %d", opens)
+	}
+	if isNew, _ := store.AddBookReader("1", "a", "2000-01-01"); !isNew {
+		t.Error("dedupe reads: reader should be new on another day")
+	}
+}
+
+func TestPruneBookReaders(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	store.AddBookReader("1", "a", "2000-01-01")
+	m.addBookRead(map[string]string{"book_id": "1", "client_id": "a"})
+
+	err := m.PruneBookReaders(time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if isNew, _ := store.AddBookReader("1", "a", "2000-01-01"); !isNew {
+		t.Error("PruneBookReaders: past day kept")
+	}
+	if isNew, _ := store.AddBookReader("1", "a", voteDay(time.Now())); isNew {
+		t.Error("PruneBookReaders: today dropped")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	_ "kkt.com/glog"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 var mgr *BookMgr
@@ -18,6 +19,10 @@ type booksGetP struct {
 	finished  bool
 	action    string
 	key       string
+	clientId  string
+	token     string
+	size      int
+	filter    *SearchFilter
 }
 
 type booksListResp struct {
@@ -25,20 +30,27 @@ type booksListResp struct {
 }
 
 type booksSearchResp struct {
-	TotalCount int     `json:"total_count"`
-	Books      []*Book `json:"books"`
+	TotalCount int           `json:"total_count"`
+	Books      []*Book       `json:"books"`
+	Filter     *SearchFilter `json:"filter"`
+	Facets     *SearchFacets `json:"facets"`
 }
 
-func createBookMgr() *BookMgr {
-	mgr, _ := NewBookMgr()
-	return mgr
+type booksSuggestResp struct {
+	Suggestions []*Suggestion `json:"suggestions"`
 }
 
-func queryBooksList(clazz string, gender string, finished bool, curPage int) (*booksListResp, error) {
+func queryBooksList(clazz string, gender string, finished bool, curPage int, clientId string, token string) (*booksListResp, error) {
 	books, err := mgr.QueryBooksList(clazz, gender, finished, curPage)
 	if nil != err {
 		return nil, err
 	}
+	if isShelfRecommend(clazz) {
+		books, err = mgr.ExcludeShelfBooks(clientId, token, books)
+		if nil != err {
+			return nil, err
+		}
+	}
 	var resp = booksListResp{Books: books}
 	return &resp, nil
 }
@@ -47,22 +59,24 @@ func queryBooksInfo(clazz string, gender string, finished bool) (*BooksInfo, err
 	return mgr.QueryBooksInfo(clazz, gender, finished)
 }
 
-func searchBooks(clazz string, curPage int) (*booksSearchResp, error) {
-	books, count, err := mgr.SearchBooks(clazz, curPage)
+func searchBooks(clazz string, filter *SearchFilter, curPage int) (*booksSearchResp, error) {
+	books, count, facets, err := mgr.SearchBooks(clazz, filter, curPage)
 	if nil != err {
 		return nil, err
 	}
-	var resp = booksSearchResp{Books: books, TotalCount: count}
+	var resp = booksSearchResp{Books: books, TotalCount: count, Filter: filter, Facets: facets}
 	return &resp, nil
 }
 
 func queryBooks(p booksGetP) (interface{}, error) {
 	if "l" == p.action {
-		return queryBooksList(p.clazz, p.gender, p.finished, int(p.pageIndex))
+		return queryBooksList(p.clazz, p.gender, p.finished, int(p.pageIndex), p.clientId, p.token)
 	} else if "c" == p.action {
 		return queryBooksInfo(p.clazz, p.gender, p.finished)
 	} else if "s" == p.action {
-		return searchBooks(p.clazz, int(p.pageIndex))
+		return searchBooks(p.clazz, p.filter, int(p.pageIndex))
+	} else if "suggest" == p.action {
+		return &booksSuggestResp{Suggestions: mgr.SuggestBooks(p.clazz, p.size)}, nil
 	}
 	return nil, errors.New("Invalid action")
 }
@@ -111,6 +125,37 @@ func booksGet(w http.ResponseWriter, r *http.Request) {
 	}
 	reqP.gender = gender
 
+	clientId := ""
+	if 0 < len(r.Form["client_id"]) {
+		clientId = r.Form["client_id"][0]
+	}
+	reqP.clientId = clientId
+
+	token := ""
+	if 0 < len(r.Form["token"]) {
+		token = r.Form["token"][0]
+	}
+	err = mgr.VerifyToken(token)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+	reqP.token = token
+
+	reqP.size, err = formIntValue(r, "n", 0)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+
+	if "s" == action {
+		reqP.filter, err = parseSearchFilter(r)
+		if nil != err {
+			Response(w, -2, err.Error(), nil)
+			return
+		}
+	}
+
 	resp, err := queryBooks(reqP)
 	if nil != err {
 		Response(w, -3, err.Error(), nil)
@@ -120,6 +165,95 @@ func booksGet(w http.ResponseWriter, r *http.Request) {
 	Response(w, 0, "", resp)
 }
 
+type recommendVersionResp struct {
+	Version  *RecommendVersion  `json:"version"`
+	Schedule *RecommendSchedule `json:"schedule,omitempty"`
+}
+
+type recommendSchedulesResp struct {
+	Schedules []*RecommendSchedule `json:"schedules"`
+}
+
+type recommendVersionsResp struct {
+	Versions []*RecommendVersion `json:"versions"`
+}
+
+type recommendDiffResp struct {
+	Diff *RecommendDiff `json:"diff"`
+}
+
+type bookVotesResp struct {
+	Votes []*Vote `json:"votes"`
+}
+
+type bookVoteResp struct {
+	Vote *Vote `json:"vote"`
+}
+
+type reindexResp struct {
+	Books int `json:"books"`
+}
+
+func operateBooks(admin *AdminKeyCfg, p apiPostP) (interface{}, error) {
+	switch p.Action {
+	case "set":
+		version, schedule, err := mgr.SetBooks(admin, p.Key, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendVersionResp{Version: version, Schedule: schedule}, nil
+	case "schedules":
+		schedules, err := mgr.QueryRecommendSchedules(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendSchedulesResp{Schedules: schedules}, nil
+	case "cancel":
+		schedule, err := mgr.CancelRecommendSchedule(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendVersionResp{Schedule: schedule}, nil
+	case "versions":
+		versions, err := mgr.QueryRecommendVersions(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendVersionsResp{Versions: versions}, nil
+	case "diff":
+		diff, err := mgr.DiffRecommendVersions(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendDiffResp{Diff: diff}, nil
+	case "rollback":
+		version, err := mgr.RollbackBooks(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &recommendVersionResp{Version: version}, nil
+	case "votes":
+		votes, err := mgr.QueryBookVotes(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &bookVotesResp{Votes: votes}, nil
+	case "revokevote":
+		vote, err := mgr.RevokeBookVote(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &bookVoteResp{Vote: vote}, nil
+	case "reindex":
+		count, err := mgr.Reindex(admin, p.Body)
+		if nil != err {
+			return nil, err
+		}
+		return &reindexResp{Books: count}, nil
+	}
+	return nil, errors.New("Invalid action")
+}
+
 func booksPost(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if nil != err {
@@ -127,6 +261,12 @@ func booksPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin, err := authenticateAdmin(r, body, time.Now())
+	if nil != err {
+		adminError(w, err)
+		return
+	}
+
 	var reqP apiPostP
 	err = json.Unmarshal(body, &reqP)
 	if nil != err {
@@ -134,23 +274,18 @@ func booksPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if "set" == reqP.Action {
-		err = mgr.SetBooks(reqP.Key, reqP.Body)
-	}
-
+	resp, err := operateBooks(admin, reqP)
 	if nil != err {
-		Response(w, -3, err.Error(), nil)
+		if !adminError(w, err) {
+			Response(w, -3, err.Error(), nil)
+		}
 		return
 	}
 
-	Response(w, 0, "", nil)
+	Response(w, 0, "", resp)
 }
 
 func BookMgrsProc(w http.ResponseWriter, r *http.Request) {
-	if nil == mgr {
-		mgr = createBookMgr()
-	}
-
 	switch r.Method {
 	case "GET":
 		booksGet(w, r)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testResp struct {
+	Code  int             `json:"code"`
+	Error string          `json:"error"`
+	Body  json.RawMessage `json:"body"`
+}
+
+func setTestBookMgr(t *testing.T) *MemBookStore {
+	m, store := newTestBookMgr(t)
+	mgr = m
+	return store
+}
+
+func doRequest(t *testing.T, handler http.HandlerFunc, method string, target string, body string, v interface{}) testResp {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	return serveRequest(t, handler, r, v)
+}
+
+func serveRequest(t *testing.T, handler http.HandlerFunc, r *http.Request, v interface{}) testResp {
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp testResp
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if nil != err {
+		t.Fatalf("%s %s: %v (%s)", r.Method, r.URL, err, w.Body.String())
+	}
+	if nil != v && 0 == resp.Code {
+		err = json.Unmarshal(resp.Body, v)
+		if nil != err {
+			t.Fatalf("%s %s: %v", r.Method, r.URL, err)
+		}
+	}
+	return resp
+}
+
+func TestBooksGetList(t *testing.T) {
+	setTestBookMgr(t)
+	var list booksListResp
+	resp := doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=reads&p=1", "", &list)
+	if 0 != resp.Code || !equalIds(list.Books, "2", "3", "1") {
+		t.Errorf("GET /books?a=l: got %+v %v", resp, bookIds(list.Books))
+	}
+
+	resp = doRequest(t, BookMgrsProc, "GET", "/books?a=l&p=x", "", nil)
+	if -2 != resp.Code {
+		t.Errorf("GET /books bad page: expected -2, got %d", resp.Code)
+	}
+
+	resp = doRequest(t, BookMgrsProc, "GET", "/books?a=x", "", nil)
+	if -3 != resp.Code {
+		t.Errorf("GET /books bad action: expected -3, got %d", resp.Code)
+	}
+}
+
+func TestBooksGetInfoAndSearch(t *testing.T) {
+	setTestBookMgr(t)
+	var info BooksInfo
+	resp := doRequest(t, BookMgrsProc, "GET", "/books?a=c", "", &info)
+	if 0 != resp.Code || 3 != info.Count {
+		t.Errorf("GET /books?a=c: got %+v %+v", resp, info)
+	}
+
+	var search booksSearchResp
+	resp = doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=忘语", "", &search)
+	if 0 != resp.Code || 1 != search.TotalCount || !equalIds(search.Books, "2") {
+		t.Errorf("GET /books?a=s: got %+v %+v", resp, search)
+	}
+}
+
+func TestBooksPostSet(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	body := `{"action":"set","key":"","body":{"clazz":"girlrecommend","books":[{"id":"3"}]}}`
+	resp := doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key")
+	if 0 != resp.Code {
+		t.Fatalf("POST /books: got %+v", resp)
+	}
+
+	var list booksListResp
+	doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=girlrecommend", "", &list)
+	if !equalIds(list.Books, "3") {
+		t.Errorf("girlrecommend: got %v", bookIds(list.Books))
+	}
+}
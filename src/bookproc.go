@@ -6,37 +6,67 @@ import (
 	"io/ioutil"
 	_ "kkt.com/glog"
 	"net/http"
+	"strconv"
 )
 
 type bookGetP struct {
-	action string
-	id     string
-	name   string
-	author string
+	action        string
+	id            string
+	name          string
+	author        string
+	offset        int
+	limit         int
+	afterNativeId int
 }
 
 type bookChaptersP struct {
+	Total    int        `json:"total"`
+	Latest   *Chapter   `json:"latest"`
 	Chapters []*Chapter `json:"chapters"`
 }
 
-func queryBookChapters(w http.ResponseWriter, p bookGetP, mgr *BookMgr) (*bookChaptersP, error) {
-	chapters, err := mgr.GetBookChapters(p.name, p.author)
+func queryBookChapters(w http.ResponseWriter, p bookGetP) (*bookChaptersP, error) {
+	chapters, total, latest, err := mgr.GetBookChapters(p.id, p.afterNativeId, p.offset, p.limit)
 	if nil != err {
 		return nil, err
 	}
 
-	var resp = bookChaptersP{Chapters: chapters}
+	var resp = bookChaptersP{Chapters: chapters, Total: total, Latest: latest}
 	return &resp, nil
 }
 
+type bookDetailP struct {
+	Book *BookDetail `json:"book"`
+}
+
+func queryBookDetail(w http.ResponseWriter, p bookGetP) (*bookDetailP, error) {
+	detail, err := mgr.GetBookDetail(p.id)
+	if nil != err {
+		return nil, err
+	}
+
+	var resp = bookDetailP{Book: detail}
+	return &resp, nil
+}
+
+func formIntValue(r *http.Request, key string, def int) (int, error) {
+	if 0 == len(r.Form[key]) {
+		return def, nil
+	}
+	return strconv.Atoi(r.Form[key][0])
+}
+
 func queryBook(w http.ResponseWriter, p bookGetP) error {
-	mgr, _ := NewBookMgr()
 	var err error
 	var resp interface{}
 
 	switch p.action {
 	case "ch":
-		resp, err = queryBookChapters(w, p, mgr)
+		resp, err = queryBookChapters(w, p)
+	case "detail":
+		resp, err = queryBookDetail(w, p)
+	default:
+		err = errors.New("Invalid action")
 	}
 
 	if nil != err {
@@ -80,11 +110,33 @@ func bookGet(w http.ResponseWriter, r *http.Request) {
 	}
 	p.author = author
 
-	if author == "" || name == "" || id == "" {
+	p.offset, err = formIntValue(r, "offset", 0)
+	if nil == err {
+		p.limit, err = formIntValue(r, "limit", 0)
+	}
+	if nil == err {
+		p.afterNativeId, err = formIntValue(r, "after_native_id", -1)
+	}
+	if nil != err {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+
+	if id == "" {
 		Response(w, -2, "Invalid parameter", nil)
 		return
 	}
 
+	token := ""
+	if 0 < len(r.Form["token"]) {
+		token = r.Form["token"][0]
+	}
+	err = mgr.VerifyToken(token)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+
 	err = queryBook(w, p)
 	if nil != err {
 		Response(w, -3, err.Error(), nil)
@@ -96,7 +148,6 @@ type bookPostRespP struct {
 }
 
 func operateBook(p apiPostP) (*bookPostRespP, error) {
-	mgr, _ := NewBookMgr()
 	var book *Book
 	var err error
 
@@ -107,6 +158,14 @@ func operateBook(p apiPostP) (*bookPostRespP, error) {
 	switch p.Key {
 	case "read":
 		book, err = mgr.addBookRead(p.Body)
+	case "vote":
+		if "del" == p.Action {
+			book, err = mgr.revokeBookVote(p.Body)
+		} else {
+			book, err = mgr.addBookVote(p.Body)
+		}
+	default:
+		err = errors.New("Invalid parameter")
 	}
 
 	if nil != err {
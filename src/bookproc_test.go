@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBookGetChapters(t *testing.T) {
+	setTestBookMgr(t)
+	var chapters bookChaptersP
+	resp := doRequest(t, BookProc, "GET", "/book?a=ch&id=1&n=斗破苍穹&au=天蚕土豆", "", &chapters)
+	if 0 != resp.Code || 2 != len(chapters.Chapters) || "c2" != chapters.Chapters[1].Id {
+		t.Errorf("GET /book?a=ch: got %+v %+v", resp, chapters)
+	}
+
+	resp = doRequest(t, BookProc, "GET", "/book?a=ch&id=1", "", &chapters)
+	if 0 != resp.Code || 2 != len(chapters.Chapters) {
+		t.Errorf("GET /book by id: got %+v %+v", resp, chapters)
+	}
+
+	resp = doRequest(t, BookProc, "GET", "/book?a=ch&n=斗破苍穹&au=天蚕土豆", "", nil)
+	if -2 != resp.Code {
+		t.Errorf("GET /book without id: expected -2, got %d", resp.Code)
+	}
+}
+
+func TestBookPostRead(t *testing.T) {
+	setTestBookMgr(t)
+	var p bookPostRespP
+	body := `{"action":"add","key":"read","body":{"book_id":"3","client_id":"c1"}}`
+	resp := doRequest(t, BookProc, "POST", "/book", body, &p)
+	if 0 != resp.Code || nil == p.Book || 21 != p.Book.TotalReads {
+		t.Errorf("POST /book read: got %+v %+v", resp, p.Book)
+	}
+
+	resp = doRequest(t, BookProc, "POST", "/book", `{"action":"add","key":"read","body":{}}`, nil)
+	if -3 != resp.Code {
+		t.Errorf("POST /book invalid: expected -3, got %d", resp.Code)
+	}
+}
+
+func TestBookGetChaptersPage(t *testing.T) {
+	store := setTestBookMgr(t)
+	chapters := make([]*Chapter, 0)
+	for i := 10; i >= 1; i-- {
+		chapters = append(chapters, &Chapter{NativeId: i, Id: "n" + strconv.Itoa(i)})
+	}
+	store.AddBookChapters("2", chapters)
+
+	var p bookChaptersP
+	resp := doRequest(t, BookProc, "GET", "/book?a=ch&id=2&offset=2&limit=3", "", &p)
+	if 0 != resp.Code || 10 != p.Total || nil == p.Latest || 10 != p.Latest.NativeId ||
+		3 != len(p.Chapters) || 3 != p.Chapters[0].NativeId || 5 != p.Chapters[2].NativeId {
+		t.Errorf("GET /book?a=ch page: got %+v %+v", resp, p)
+	}
+
+	p = bookChaptersP{}
+	resp = doRequest(t, BookProc, "GET", "/book?a=ch&id=2&after_native_id=7", "", &p)
+	if 0 != resp.Code || 3 != p.Total || 3 != len(p.Chapters) || 8 != p.Chapters[0].NativeId {
+		t.Errorf("GET /book?a=ch after: got %+v %+v", resp, p)
+	}
+
+	p = bookChaptersP{}
+	resp = doRequest(t, BookProc, "GET", "/book?a=ch&id=2&after_native_id=10", "", &p)
+	if 0 != resp.Code || 0 != p.Total || 0 != len(p.Chapters) || 10 != p.Latest.NativeId {
+		t.Errorf("GET /book?a=ch up to date: got %+v %+v", resp, p)
+	}
+
+	for _, target := range []string{"/book?a=ch&id=2&offset=x", "/book?a=ch&id=2&limit=x",
+		"/book?a=ch&id=2&after_native_id=x"} {
+		if resp = doRequest(t, BookProc, "GET", target, "", nil); -2 != resp.Code {
+			t.Errorf("GET %s: expected -2, got %+v", target, resp)
+		}
+	}
+}
+
+func TestBookGetDetail(t *testing.T) {
+	setTestBookMgr(t)
+	mgr.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "fprecommend", "books": []map[string]string{{"id": "1"}}})
+	mgr.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "directorrecommend",
+		"books": []map[string]string{{"id": "1", "rwords": "好看", "ruser": "编辑"}}})
+
+	var p struct {
+		Book struct {
+			Book
+			ReadingMinutes int      `json:"reading_minutes"`
+			ChapterCount   int      `json:"chapter_count"`
+			LatestChapter  *Chapter `json:"latest_chapter"`
+			RecommendLists []string `json:"recommend_lists"`
+		} `json:"book"`
+	}
+	resp := doRequest(t, BookProc, "GET", "/book?a=detail&id=1", "", &p)
+	if 0 != resp.Code || "斗破苍穹" != p.Book.Name || 10000 != p.Book.ReadingMinutes ||
+		2 != p.Book.ChapterCount || nil == p.Book.LatestChapter || "c2" != p.Book.LatestChapter.Id ||
+		!equalStrings(p.Book.RecommendLists, "directorrecommend", "fprecommend") {
+		t.Errorf("GET /book?a=detail: got %+v %+v", resp, p.Book)
+	}
+
+	resp = doRequest(t, BookProc, "GET", "/book?a=detail&id=3", "", &p)
+	if 0 != resp.Code || 0 != p.Book.ChapterCount || nil != p.Book.LatestChapter || 0 != len(p.Book.RecommendLists) {
+		t.Errorf("GET /book?a=detail no chapters: got %+v %+v", resp, p.Book)
+	}
+
+	if resp = doRequest(t, BookProc, "GET", "/book?a=detail&id=404", "", nil); -3 != resp.Code {
+		t.Errorf("GET /book?a=detail unknown: expected -3, got %+v", resp)
+	}
+	if resp = doRequest(t, BookProc, "GET", "/book?a=x&id=1", "", nil); -3 != resp.Code {
+		t.Errorf("GET /book?a=x: expected -3, got %+v", resp)
+	}
+}
+
+func TestBookPostReadConcurrent(t *testing.T) {
+	store := setTestBookMgr(t)
+	const n = 64
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"action":"add","key":"read","body":{"book_id":"1","client_id":"c` + strconv.Itoa(i) + `"}}`
+			r := httptest.NewRequest("POST", "/book", strings.NewReader(body))
+			BookProc(httptest.NewRecorder(), r)
+		}(i)
+	}
+	wg.Wait()
+	mgr.FlushCounters()
+
+	book, _ := store.GetBook("1")
+	if 10+n != book.TotalReads {
+		t.Errorf("concurrent reads: expected %d, got %d", 10+n, book.TotalReads)
+	}
+}
+
+func TestUpdateSearchesConcurrent(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	book, _ := store.GetBook("2")
+	const n = 64
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.updateSearches([]*Book{book}, "忘语")
+		}()
+	}
+	wg.Wait()
+	m.FlushCounters()
+
+	book, _ = store.GetBook("2")
+	count, _ := store.GetSearchWordCount("忘语")
+	if n != book.TotalSearches || n != count {
+		t.Errorf("concurrent searches: expected %d, got %d/%d", n, book.TotalSearches, count)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	orderByVotes    = "total_votes"
+	orderByReads    = "total_reads"
+	orderBySearches = "total_searches"
+	orderByChars    = "total_chars"
+	orderByScore    = "score"
+	orderById       = "id"
+)
+
+type BookFilter struct {
+	Clazz    string
+	Gender   string
+	Finished bool
+}
+
+type BookCounters struct {
+	Reads    int
+	Searches int
+	Votes    int
+	Opens    int
+}
+
+type BookStore interface {
+	QueryBooks(filter BookFilter, order string, offset int, limit int) ([]*Book, error)
+	CountBooks(filter BookFilter) (int, error)
+	QueryClazzs(filter BookFilter) ([]string, error)
+	GetBook(id string) (*Book, error)
+
+	QueryRecommendBooks(table string, notes bool, filter BookFilter) ([]*Book, error)
+	SetRecommendBooks(table string, notes bool, books []recommendBook, version *RecommendVersion) error
+	IsRecommendBook(table string, bookId string) (bool, error)
+	QueryRecommendVersions(clazz string, offset int, limit int) ([]*RecommendVersion, error)
+	GetRecommendVersion(clazz string, version int) (*RecommendVersion, error)
+	AddRecommendSchedule(schedule *RecommendSchedule) error
+	GetRecommendSchedule(id int64) (*RecommendSchedule, error)
+	UpdateRecommendSchedule(schedule *RecommendSchedule, fromState string) (bool, error)
+	QueryDueRecommendSchedules(now int64) ([]*RecommendSchedule, error)
+	QueryRecommendSchedules(clazz string, offset int, limit int) ([]*RecommendSchedule, error)
+
+	SearchBooks(key string, offset int, limit int) ([]*Book, error)
+	CountSearchBooks(key string) (int, error)
+
+	GetBookChapters(bookId string) ([]*Chapter, error)
+	QueryBookChapters(bookId string, afterNativeId int, offset int, limit int) ([]*Chapter, error)
+	CountBookChapters(bookId string, afterNativeId int) (int, error)
+	GetLatestBookChapter(bookId string) (*Chapter, error)
+	GetChapterContent(bookId string, chapterId string) (*StoredChapterContent, error)
+	SaveChapterContent(content *StoredChapterContent) error
+
+	IncBookCounters(deltas map[string]BookCounters) error
+	AddBookReader(bookId string, clientId string, day string) (bool, error)
+	DeleteBookReaders(beforeDay string) error
+	GetBookOpens(bookId string) (int, error)
+
+	AddShelfBook(entry *ShelfEntry) (bool, error)
+	RemoveShelfBook(clientId string, bookId string) (bool, error)
+	QueryShelfBooks(clientId string) ([]*ShelfEntry, error)
+	SetShelfPositions(clientId string, bookIds []string) error
+	MarkShelfBookOpened(clientId string, bookId string, seenNativeId int, openedAt int64) error
+
+	SaveReadingProgress(progress *ReadingProgress) (bool, error)
+	GetReadingProgress(clientId string, bookId string) (*ReadingProgress, error)
+	QueryReadingProgress(clientId string, offset int, limit int) ([]*ReadingProgress, error)
+
+	AddAccount(account *Account) error
+	GetAccount(id int64) (*Account, error)
+	GetAccountByName(name string) (*Account, error)
+	LinkClient(clientId string, accountId int64) error
+	SetClientSecret(clientId string, secretHash string) (bool, error)
+	GetClientSecret(clientId string) (string, error)
+	GetClientAccount(clientId string) (int64, error)
+	QueryAccountClients(accountId int64) ([]string, error)
+	MoveOwnerData(from string, to string) error
+
+	AddVote(vote *Vote) error
+	CountClientVotes(clientId string, bookId string, day string) (int, error)
+	QueryClientVotes(clientId string, bookId string, day string) ([]*Vote, error)
+	QueryBookVotes(bookId string, offset int, limit int) ([]*Vote, error)
+	RevokeVote(id int64) (*Vote, error)
+
+	QueryHotWords(limit int) ([]string, error)
+	QueryTopSearchWords(limit int) ([]string, error)
+	GetSearchWordCount(word string) (int, error)
+	IncSearchWord(word string, delta int) error
+}
+
+func bookChaptersKey(name string, author string) string {
+	key := sha256.Sum256([]byte(name + author))
+	return hex.EncodeToString(key[0:])
+}
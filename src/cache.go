@@ -0,0 +1,136 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"kkt.com/glog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLRUSize   = 1024
+	defaultListTTL   = 60
+	defaultInfoTTL   = 300
+	defaultSearchTTL = 60
+	defaultHomeTTL   = 60
+)
+
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	DeletePrefix(prefix string)
+}
+
+func NewCache(cfg *CacheCfg) Cache {
+	if "" != cfg.Redis.Host {
+		cache, err := NewRedisCache(&cfg.Redis)
+		if nil == err {
+			return cache
+		}
+		glog.Error(err, ", fall back to lru cache")
+	}
+	size := cfg.LRUSize
+	if 0 >= size {
+		size = defaultLRUSize
+	}
+	return NewLRUCache(size)
+}
+
+func cacheTTL(seconds int, def int) time.Duration {
+	if 0 >= seconds {
+		seconds = def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func cacheGetJSON(cache Cache, key string, v interface{}) bool {
+	value, ok := cache.Get(key)
+	if !ok {
+		return false
+	}
+	err := json.Unmarshal(value, v)
+	if nil != err {
+		glog.Warning(err)
+		return false
+	}
+	return true
+}
+
+func cacheSetJSON(cache Cache, key string, v interface{}, ttl time.Duration) {
+	value, err := json.Marshal(v)
+	if nil != err {
+		glog.Warning(err)
+		return
+	}
+	cache.Set(key, value, ttl)
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+type LRUCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries *list.List
+	items   map[string]*list.Element
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		entries: list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		c.entries.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.entries.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expireAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expireAt = expireAt
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.entries.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for c.entries.Len() > c.size {
+		elem := c.entries.Back()
+		c.entries.Remove(elem)
+		delete(c.items, elem.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) DeletePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.entries.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+}
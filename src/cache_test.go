@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	c.Get("a")
+	c.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("LRUCache: expected b evicted")
+	}
+	if v, ok := c.Get("a"); !ok || "1" != string(v) {
+		t.Errorf("LRUCache: expected a, got %q %v", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || "3" != string(v) {
+		t.Errorf("LRUCache: expected c, got %q %v", v, ok)
+	}
+}
+
+func TestLRUCacheExpire(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", []byte("1"), -time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("LRUCache: expected a expired")
+	}
+}
+
+func TestLRUCacheDeletePrefix(t *testing.T) {
+	c := NewLRUCache(8)
+	c.Set("books:l:fprecommend:default", []byte("1"), time.Minute)
+	c.Set("books:l:fprecommend:girl", []byte("2"), time.Minute)
+	c.Set("books:l:girlrecommend:girl", []byte("3"), time.Minute)
+	c.DeletePrefix("books:l:fprecommend:")
+
+	if _, ok := c.Get("books:l:fprecommend:girl"); ok {
+		t.Error("DeletePrefix: expected key deleted")
+	}
+	if _, ok := c.Get("books:l:girlrecommend:girl"); !ok {
+		t.Error("DeletePrefix: unexpected key deleted")
+	}
+}
+
+func TestBookMgrListCache(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	books, _ := m.QueryBooksList("reads", "default", false, 0)
+	if !equalIds(books, "2", "3", "1") {
+		t.Fatalf("QueryBooksList: got %v", bookIds(books))
+	}
+
+	store.IncBookCounters(map[string]BookCounters{"1": {Reads: 90}})
+	books, _ = m.QueryBooksList("reads", "default", false, 0)
+	if !equalIds(books, "2", "3", "1") {
+		t.Errorf("QueryBooksList: expected cached order, got %v", bookIds(books))
+	}
+
+	m.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "fprecommend", "books": []map[string]string{{"id": "1"}}})
+	books, _ = m.QueryBooksList("fprecommend", "default", false, 0)
+	if !equalIds(books, "1") {
+		t.Fatalf("fprecommend: got %v", bookIds(books))
+	}
+	m.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "fprecommend", "books": []map[string]string{{"id": "2"}}})
+	books, _ = m.QueryBooksList("fprecommend", "default", false, 0)
+	if !equalIds(books, "2") {
+		t.Errorf("fprecommend: expected invalidated list, got %v", bookIds(books))
+	}
+}
+
+func TestBookMgrInfoCache(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	info, _ := m.QueryBooksInfo("", "default", false)
+	store.AddBook(&Book{Id: "4", Name: "新书", Class: "都市"})
+	cached, _ := m.QueryBooksInfo("", "default", false)
+	if info.Count != cached.Count || 3 != cached.Count {
+		t.Errorf("QueryBooksInfo: expected cached count 3, got %d", cached.Count)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+)
+
+func chapterGet(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	var id = ""
+	if 0 < len(r.Form["id"]) {
+		id = r.Form["id"][0]
+	}
+
+	var chapterId = ""
+	if 0 < len(r.Form["cid"]) {
+		chapterId = r.Form["cid"][0]
+	}
+
+	if "" == id || "" == chapterId {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+
+	content, err := mgr.GetChapterContent(id, chapterId)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", content)
+}
+
+func ChapterProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		chapterGet(w, r)
+	}
+}
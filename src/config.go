@@ -2,18 +2,28 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"io/ioutil"
 	"kkt.com/glog"
 )
 
+type ContentCleanupCfg struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
 type ContentSpecCfg struct {
-	Host          string `json:"host"`
-	Start         string `json:"start"`
-	End           string `json:"end"`
-	CharSet       string `json:"charset"`
-	ChapterPrefix string `json:"chapter_prefix"`
-	PType         string `json:"ptype"`
+	Host          string              `json:"host"`
+	Start         string              `json:"start"`
+	End           string              `json:"end"`
+	CharSet       string              `json:"charset"`
+	ChapterPrefix string              `json:"chapter_prefix"`
+	PType         string              `json:"ptype"`
+	Pattern       string              `json:"pattern,omitempty"`
+	Selector      string              `json:"selector,omitempty"`
+	Cleanup       []ContentCleanupCfg `json:"cleanup,omitempty"`
 }
 
 type MysqlCfg struct {
@@ -23,12 +33,102 @@ type MysqlCfg struct {
 	Db       string `json:"db"`
 }
 
+type RedisCfg struct {
+	Host     string `json:"host"`
+	Password string `json:"password"`
+	Db       int    `json:"db"`
+}
+
+type CacheCfg struct {
+	Redis     RedisCfg `json:"redis"`
+	LRUSize   int      `json:"lru_size"`
+	ListTTL   int      `json:"list_ttl"`
+	InfoTTL   int      `json:"info_ttl"`
+	SearchTTL int      `json:"search_ttl"`
+	HomeTTL   int      `json:"home_ttl"`
+}
+
+type ContentCacheCfg struct {
+	VipRefresh     int `json:"vip_refresh"`
+	RecentRefresh  int `json:"recent_refresh"`
+	RecentChapters int `json:"recent_chapters"`
+	MaxPageSize    int `json:"max_page_size"`
+}
+
+type CounterCfg struct {
+	FlushInterval       int `json:"flush_interval"`
+	FlushSize           int `json:"flush_size"`
+	ReaderPruneInterval int `json:"reader_prune_interval"`
+}
+
+type VoteCfg struct {
+	PerBookDaily int `json:"per_book_daily"`
+	DailyBudget  int `json:"daily_budget"`
+}
+
+type AccountCfg struct {
+	TokenSecret string `json:"token_secret"`
+	TokenTTL    int    `json:"token_ttl"`
+}
+
+type AdminKeyCfg struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role string `json:"role"`
+}
+
+type AdminCfg struct {
+	Keys    []AdminKeyCfg `json:"keys"`
+	MaxSkew int           `json:"max_skew"`
+}
+
+type ScheduleCfg struct {
+	Interval int `json:"interval"`
+}
+
+type RecommendListCfg struct {
+	Name    string `json:"name"`
+	Table   string `json:"table"`
+	Gender  string `json:"gender"`
+	Notes   bool   `json:"notes"`
+	Editor  bool   `json:"editor"`
+	MaxSize int    `json:"max_size"`
+}
+
+type HomeSectionCfg struct {
+	Title  string `json:"title"`
+	List   string `json:"list"`
+	Size   int    `json:"size"`
+	Gender string `json:"gender"`
+}
+
+type HomeCfg struct {
+	Sections []HomeSectionCfg `json:"sections"`
+}
+
+type SearchCfg struct {
+	RefreshInterval int `json:"refresh_interval"`
+	SuggestSize     int `json:"suggest_size"`
+	HotWords        int `json:"hot_words"`
+}
+
 type config struct {
-	Mysql       MysqlCfg         `json:"mysql"`
-	ContentSpec []ContentSpecCfg `json:"content_spec"`
+	Mysql          MysqlCfg           `json:"mysql"`
+	Cache          CacheCfg           `json:"cache"`
+	ContentCache   ContentCacheCfg    `json:"content_cache"`
+	Counter        CounterCfg         `json:"counter"`
+	Vote           VoteCfg            `json:"vote"`
+	Account        AccountCfg         `json:"account"`
+	Admin          AdminCfg           `json:"admin"`
+	Schedule       ScheduleCfg        `json:"schedule"`
+	RecommendLists []RecommendListCfg `json:"recommend_lists"`
+	Home           HomeCfg            `json:"home"`
+	Search         SearchCfg          `json:"search"`
+	ContentSpec    []ContentSpecCfg   `json:"content_spec"`
 }
 
 var cfg config
+var cfgMigration string
 
 func init() {
 	glog.ToStderr(true)
@@ -36,7 +136,9 @@ func init() {
 
 func ConfigInitialize() {
 	cfgFile := flag.String("c", "./server-config.json", "Set `config file`")
+	migration := flag.String("m", "", "Run one-shot `migration` (chapters) and exit")
 	flag.Parse()
+	cfgMigration = *migration
 
 	body, err := ioutil.ReadFile(*cfgFile)
 	if nil != err {
@@ -48,4 +150,23 @@ func ConfigInitialize() {
 	if nil != err {
 		glog.Error(err)
 	}
+	for _, list := range cfg.RecommendLists {
+		if !sqlIdentifier.MatchString(list.Table) {
+			glog.Error("Invalid table of recommend list ", list.Name, ": ", list.Table)
+		}
+	}
+}
+
+func ValidateConfig() error {
+	err := validateRecommendLists(cfg.RecommendLists)
+	if nil != err {
+		return err
+	}
+	for _, spec := range cfg.ContentSpec {
+		err := validateContentCleanup(spec.Cleanup)
+		if nil != err {
+			return errors.New("Invalid content spec " + spec.Host + ": " + err.Error())
+		}
+	}
+	return nil
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVipRefresh     = 3600
+	defaultRecentRefresh  = 600
+	defaultRecentChapters = 3
+	defaultMaxPageSize    = 2 << 20
+)
+
+type ChapterContent struct {
+	BookId     string   `json:"book_id"`
+	ChapterId  string   `json:"chapter_id"`
+	Title      string   `json:"title"`
+	Vip        bool     `json:"vip"`
+	Source     string   `json:"source"`
+	FetchedAt  int64    `json:"fetched_at"`
+	Paragraphs []string `json:"paragraphs"`
+}
+
+type StoredChapterContent struct {
+	BookId     string
+	ChapterId  string
+	Host       string
+	Checksum   string
+	FetchedAt  time.Time
+	Paragraphs []string
+}
+
+func contentChecksum(paragraphs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(paragraphs, "\n")))
+	return hex.EncodeToString(sum[0:])
+}
+
+func NewStoredChapterContent(bookId string, chapterId string, host string, paragraphs []string) *StoredChapterContent {
+	return &StoredChapterContent{
+		BookId:     bookId,
+		ChapterId:  chapterId,
+		Host:       host,
+		Checksum:   contentChecksum(paragraphs),
+		FetchedAt:  time.Now(),
+		Paragraphs: paragraphs,
+	}
+}
+
+func (c *StoredChapterContent) Verify() bool {
+	return c.Checksum == contentChecksum(c.Paragraphs)
+}
+
+func maxPageSize() int {
+	if 0 >= cfg.ContentCache.MaxPageSize {
+		return defaultMaxPageSize
+	}
+	return cfg.ContentCache.MaxPageSize
+}
+
+func recentChapters() int {
+	if 0 >= cfg.ContentCache.RecentChapters {
+		return defaultRecentChapters
+	}
+	return cfg.ContentCache.RecentChapters
+}
+
+var contentBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|\r?\n`)
+var contentTagRegexp = regexp.MustCompile(`(?s)<[^>]*>`)
+
+func findContentSpec(specs []ContentSpecCfg, rawurl string) *ContentSpecCfg {
+	u, err := url.Parse(rawurl)
+	if nil != err || "" == u.Hostname() {
+		return nil
+	}
+	for i, spec := range specs {
+		host := u.Hostname()
+		if "" != spec.Host && (spec.Host == host || strings.HasSuffix(host, "."+spec.Host)) {
+			return &specs[i]
+		}
+	}
+	return nil
+}
+
+func chapterContentUrl(spec *ContentSpecCfg, chapterUrl string) string {
+	if "" == spec.ChapterPrefix || strings.Contains(chapterUrl, "://") {
+		return chapterUrl
+	}
+	return spec.ChapterPrefix + strings.TrimPrefix(chapterUrl, "/")
+}
+
+func decodeContent(body []byte, charset string) (string, error) {
+	if "" == charset {
+		return string(body), nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if nil != err {
+		return "", err
+	}
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), body)
+	if nil != err {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+func fetchContentPage(client *http.Client, rawurl string, charset string) (string, error) {
+	resp, err := client.Get(rawurl)
+	if nil != err {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if http.StatusOK != resp.StatusCode {
+		return "", errors.New("Fail to fetch chapter: " + resp.Status)
+	}
+
+	limit := maxPageSize()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if nil != err {
+		return "", err
+	}
+	if len(body) > limit {
+		return "", errors.New("Chapter page too large")
+	}
+	return decodeContent(body, charset)
+}
+
+func cleanParagraphs(text string) []string {
+	paragraphs := make([]string, 0)
+	for _, line := range contentBreakRegexp.Split(text, -1) {
+		line = contentTagRegexp.ReplaceAllString(line, "")
+		line = html.UnescapeString(line)
+		line = strings.TrimSpace(strings.Trim(line, " 　 \t"))
+		if "" != line {
+			paragraphs = append(paragraphs, line)
+		}
+	}
+	return paragraphs
+}
+
+func extractStartEnd(page string, spec *ContentSpecCfg) ([]string, error) {
+	start := strings.Index(page, spec.Start)
+	if 0 > start {
+		return nil, errors.New("Chapter content not found")
+	}
+	page = page[start+len(spec.Start):]
+	end := strings.Index(page, spec.End)
+	if 0 > end {
+		return nil, errors.New("Chapter content not found")
+	}
+	return cleanParagraphs(page[:end]), nil
+}
+
+func extractSegment(page string, spec *ContentSpecCfg) ([]string, error) {
+	paragraphs := make([]string, 0)
+	for {
+		start := strings.Index(page, spec.Start)
+		if 0 > start {
+			break
+		}
+		page = page[start+len(spec.Start):]
+		end := strings.Index(page, spec.End)
+		if 0 > end {
+			break
+		}
+		paragraphs = append(paragraphs, cleanParagraphs(page[:end])...)
+		page = page[end+len(spec.End):]
+	}
+	if 0 == len(paragraphs) {
+		return nil, errors.New("Chapter content not found")
+	}
+	return paragraphs, nil
+}
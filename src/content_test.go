@@ -0,0 +1,243 @@
+package main
+
+import (
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGbkPage = `<html><head><title>第一章</title></head><body>
+<div id="BookText">&nbsp;&nbsp;&nbsp;&nbsp;三十年河东，三十年河西。<br /><br />
+&nbsp;&nbsp;&nbsp;&nbsp;莫欺<b>少年</b>穷！<br/></div>
+<div class="footer">footer</div></body></html>`
+
+const testSegmentPage = `<html><body>
+<p class="p-content" style="text-indent: 2em">第一段</p>
+<p>ignored</p>
+<p class="p-content" style="text-indent: 2em">　　第二段&amp;</p>
+</body></html>`
+
+func equalStrings(got []string, expect ...string) bool {
+	if len(got) != len(expect) {
+		return false
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newTestContentServer(t *testing.T) *httptest.Server {
+	gbkPage, err := simplifiedchinese.GBK.NewEncoder().String(testGbkPage)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.html":
+			w.Write([]byte(gbkPage))
+		case "/Book/Chapter/2":
+			w.Write([]byte(testSegmentPage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func setTestContentSpec(specs []ContentSpecCfg) func() {
+	old := cfg.ContentSpec
+	cfg.ContentSpec = specs
+	return func() {
+		cfg.ContentSpec = old
+	}
+}
+
+func TestExtractStartEnd(t *testing.T) {
+	spec := ContentSpecCfg{PType: "start_end", Start: `<div id="BookText">`, End: "</div>"}
+	paragraphs, err := extractContent(testGbkPage, &spec)
+	if nil != err || !equalStrings(paragraphs, "三十年河东，三十年河西。", "莫欺少年穷！") {
+		t.Errorf("start_end: got %q, %v", paragraphs, err)
+	}
+
+	spec.Start = "<nothing>"
+	if _, err := extractContent(testGbkPage, &spec); nil == err {
+		t.Error("start_end: expected error for missing start")
+	}
+}
+
+func TestExtractSegment(t *testing.T) {
+	spec := ContentSpecCfg{PType: "segment", Start: `<p class="p-content" style="text-indent: 2em">`, End: "</p>"}
+	paragraphs, err := extractContent(testSegmentPage, &spec)
+	if nil != err || !equalStrings(paragraphs, "第一段", "第二段&") {
+		t.Errorf("segment: got %q, %v", paragraphs, err)
+	}
+
+	spec.PType = "unknown"
+	if _, err := extractContent(testSegmentPage, &spec); nil == err {
+		t.Error("unknown ptype: expected error")
+	}
+}
+
+func TestFindContentSpec(t *testing.T) {
+	specs := []ContentSpecCfg{{Host: "59xs.com"}, {Host: "365haoshu.com", ChapterPrefix: "http://www.365haoshu.com/Book/Chapter/"}}
+	for _, rawurl := range []string{"http://www.59xs.com/1.html", "http://59xs.com:8080/1.html"} {
+		if spec := findContentSpec(specs, rawurl); nil == spec || "59xs.com" != spec.Host {
+			t.Errorf("findContentSpec(%s): got %+v", rawurl, spec)
+		}
+	}
+	for _, rawurl := range []string{"http://www.unknown.com/1.html", "http://59xs.com.evil.net/1.html",
+		"http://evil59xs.com/1.html"} {
+		if spec := findContentSpec(specs, rawurl); nil != spec {
+			t.Errorf("findContentSpec(%s): expected nil, got %+v", rawurl, spec)
+		}
+	}
+	if u := chapterContentUrl(&specs[1], "123"); "http://www.365haoshu.com/Book/Chapter/123" != u {
+		t.Errorf("chapterContentUrl: got %s", u)
+	}
+}
+
+func TestChapterGet(t *testing.T) {
+	server := newTestContentServer(t)
+	defer server.Close()
+
+	defer setTestContentSpec([]ContentSpecCfg{{
+		Host: "127.0.0.1", PType: "start_end", Start: `<div id="BookText">`, End: "</div>", CharSet: "gbk",
+	}})()
+	store := setTestBookMgr(t)
+	store.AddBook(&Book{Id: "9", Name: "测试", Author: "作者", LastChapterUrl: server.URL + "/1.html"})
+	store.AddBookChapters("9", []*Chapter{
+		{NativeId: 1, Id: "c1", Title: "第一章", Url: server.URL + "/1.html"},
+		{NativeId: 2, Id: "c2", Title: "第二章", Url: server.URL + "/404.html"},
+	})
+
+	var content ChapterContent
+	resp := doRequest(t, ChapterProc, "GET", "/chapter?id=9&cid=c1", "", &content)
+	if 0 != resp.Code || "第一章" != content.Title ||
+		!equalStrings(content.Paragraphs, "三十年河东，三十年河西。", "莫欺少年穷！") {
+		t.Errorf("GET /chapter: got %+v %+v", resp, content)
+	}
+
+	resp = doRequest(t, ChapterProc, "GET", "/chapter?id=9&cid=c2", "", nil)
+	if -3 != resp.Code || !strings.Contains(resp.Error, "404") {
+		t.Errorf("GET /chapter missing page: got %+v", resp)
+	}
+
+	for _, target := range []string{"/chapter?id=9", "/chapter?cid=c1"} {
+		if resp = doRequest(t, ChapterProc, "GET", target, "", nil); -2 != resp.Code {
+			t.Errorf("GET %s: expected -2, got %+v", target, resp)
+		}
+	}
+	if resp = doRequest(t, ChapterProc, "GET", "/chapter?id=9&cid=c9", "", nil); -3 != resp.Code {
+		t.Errorf("GET /chapter unknown chapter: expected -3, got %+v", resp)
+	}
+}
+
+func TestFetchContentPageLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("章", 100)))
+	}))
+	defer server.Close()
+	old := cfg.ContentCache.MaxPageSize
+	defer func() { cfg.ContentCache.MaxPageSize = old }()
+
+	cfg.ContentCache.MaxPageSize = 300
+	if page, err := fetchContentPage(server.Client(), server.URL, ""); nil != err || 100 != len([]rune(page)) {
+		t.Errorf("fetchContentPage: got %d runes, %v", len([]rune(page)), err)
+	}
+	cfg.ContentCache.MaxPageSize = 299
+	if _, err := fetchContentPage(server.Client(), server.URL, ""); nil == err {
+		t.Error("fetchContentPage: expected error for a page over the limit")
+	}
+}
+
+func TestChapterGetPrefix(t *testing.T) {
+	server := newTestContentServer(t)
+	defer server.Close()
+
+	defer setTestContentSpec([]ContentSpecCfg{{
+		Host: "127.0.0.1", PType: "segment", Start: `<p class="p-content" style="text-indent: 2em">`,
+		End: "</p>", CharSet: "utf-8", ChapterPrefix: server.URL + "/Book/Chapter/",
+	}})()
+	store := setTestBookMgr(t)
+	store.AddBook(&Book{Id: "9", Name: "测试", Author: "作者", LastChapterUrl: server.URL + "/Book/Chapter/2"})
+	store.AddBookChapters("9", []*Chapter{{NativeId: 2, Id: "c2", Title: "第二章", Url: "2"}})
+
+	var content ChapterContent
+	resp := doRequest(t, ChapterProc, "GET", "/chapter?id=9&cid=c2", "", &content)
+	if 0 != resp.Code || !equalStrings(content.Paragraphs, "第一段", "第二段&") {
+		t.Errorf("GET /chapter: got %+v %+v", resp, content)
+	}
+}
+
+func TestChapterContentStore(t *testing.T) {
+	hits := 0
+	body := `<div id="BookText">旧内容</div>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits += 1
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	defer setTestContentSpec([]ContentSpecCfg{{
+		Host: "127.0.0.1", PType: "start_end", Start: `<div id="BookText">`, End: "</div>",
+	}})()
+	store := setTestBookMgr(t)
+	store.AddBook(&Book{Id: "9", Name: "测试", Author: "作者"})
+	chapters := []*Chapter{
+		{NativeId: 1, Id: "c1", Url: server.URL + "/1.html"},
+		{NativeId: 2, Id: "c2", Url: server.URL + "/2.html", Vip: true},
+	}
+	for i := 3; i <= 6; i++ {
+		chapters = append(chapters, &Chapter{NativeId: i, Id: "x", Url: server.URL + "/x.html"})
+	}
+	store.AddBookChapters("9", chapters)
+
+	content, err := mgr.GetChapterContent("9", "c1")
+	if nil != err || 1 != hits || !equalStrings(content.Paragraphs, "旧内容") || "127.0.0.1" != content.Source {
+		t.Fatalf("GetChapterContent: got %+v, %v, %d hits", content, err, hits)
+	}
+	stored, _ := store.GetChapterContent("9", "c1")
+	if nil == stored || !stored.Verify() {
+		t.Fatalf("GetChapterContent: not stored, got %+v", stored)
+	}
+
+	body = `<div id="BookText">新内容</div>`
+	stored.FetchedAt = stored.FetchedAt.Add(-365 * 24 * time.Hour)
+	store.SaveChapterContent(stored)
+	content, _ = mgr.GetChapterContent("9", "c1")
+	if 1 != hits || !equalStrings(content.Paragraphs, "旧内容") {
+		t.Errorf("old chapter: expected stored content, got %q, %d hits", content.Paragraphs, hits)
+	}
+
+	stored.Paragraphs = []string{"篡改"}
+	store.SaveChapterContent(stored)
+	content, _ = mgr.GetChapterContent("9", "c1")
+	if 2 != hits || !equalStrings(content.Paragraphs, "新内容") {
+		t.Errorf("checksum mismatch: expected refetch, got %q, %d hits", content.Paragraphs, hits)
+	}
+
+	mgr.GetChapterContent("9", "c2")
+	vip, _ := store.GetChapterContent("9", "c2")
+	vip.FetchedAt = vip.FetchedAt.Add(-2 * time.Hour)
+	vip.Paragraphs = []string{"过期"}
+	vip.Checksum = contentChecksum(vip.Paragraphs)
+	store.SaveChapterContent(vip)
+	content, _ = mgr.GetChapterContent("9", "c2")
+	if 4 != hits || !equalStrings(content.Paragraphs, "新内容") {
+		t.Errorf("vip chapter: expected refresh, got %q, %d hits", content.Paragraphs, hits)
+	}
+
+	vip, _ = store.GetChapterContent("9", "c2")
+	vip.FetchedAt = vip.FetchedAt.Add(-2 * time.Hour)
+	store.SaveChapterContent(vip)
+	server.Close()
+	content, err = mgr.GetChapterContent("9", "c2")
+	if nil != err || !equalStrings(content.Paragraphs, "新内容") {
+		t.Errorf("source down: expected stale content, got %+v, %v", content, err)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"kkt.com/glog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFlushInterval       = 5
+	defaultFlushSize           = 1000
+	defaultReaderPruneInterval = 3600
+)
+
+type CounterStats struct {
+	Flushes         int64  `json:"flushes"`
+	FailedFlushes   int64  `json:"failed_flushes"`
+	FlushedBooks    int64  `json:"flushed_books"`
+	FlushedReads    int64  `json:"flushed_reads"`
+	FlushedSearches int64  `json:"flushed_searches"`
+	FlushedVotes    int64  `json:"flushed_votes"`
+	FlushedOpens    int64  `json:"flushed_opens"`
+	FlushedWords    int64  `json:"flushed_words"`
+	PendingBooks    int    `json:"pending_books"`
+	PendingWords    int    `json:"pending_words"`
+	LastFlushAt     int64  `json:"last_flush_at"`
+	LastError       string `json:"last_error,omitempty"`
+}
+
+type CounterAggregator struct {
+	mutex      sync.Mutex
+	flushMutex sync.Mutex
+	store      BookStore
+	books      map[string]BookCounters
+	words      map[string]int
+	flushSize  int
+	onFlush    func(books map[string]BookCounters)
+	stats      CounterStats
+	flushCh    chan struct{}
+	closeCh    chan struct{}
+	doneCh     chan struct{}
+	closeOnce  sync.Once
+}
+
+func NewCounterAggregator(store BookStore, interval time.Duration, flushSize int) *CounterAggregator {
+	a := &CounterAggregator{
+		store:     store,
+		books:     make(map[string]BookCounters),
+		words:     make(map[string]int),
+		flushSize: flushSize,
+		flushCh:   make(chan struct{}, 1),
+		closeCh:   make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go a.run(interval)
+	return a
+}
+
+func (a *CounterAggregator) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(a.doneCh)
+
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.flushCh:
+			a.Flush()
+		case <-a.closeCh:
+			a.Flush()
+			return
+		}
+	}
+}
+
+func (a *CounterAggregator) OnFlush(fn func(books map[string]BookCounters)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.onFlush = fn
+}
+
+func (a *CounterAggregator) pendingSize() int {
+	return len(a.books) + len(a.words)
+}
+
+func (a *CounterAggregator) notifyFull() {
+	if a.pendingSize() < a.flushSize {
+		return
+	}
+	select {
+	case a.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (a *CounterAggregator) Add(id string, delta BookCounters) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	c := a.books[id]
+	c.Reads += delta.Reads
+	c.Searches += delta.Searches
+	c.Votes += delta.Votes
+	c.Opens += delta.Opens
+	a.books[id] = c
+	a.notifyFull()
+}
+
+func (a *CounterAggregator) AddSearchWord(word string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.words[word] += 1
+	a.notifyFull()
+}
+
+func (a *CounterAggregator) Pending(id string) BookCounters {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.books[id]
+}
+
+func (a *CounterAggregator) restore(books map[string]BookCounters, words map[string]int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for id, delta := range books {
+		c := a.books[id]
+		c.Reads += delta.Reads
+		c.Searches += delta.Searches
+		c.Votes += delta.Votes
+		c.Opens += delta.Opens
+		a.books[id] = c
+	}
+	for word, delta := range words {
+		a.words[word] += delta
+	}
+}
+
+func (a *CounterAggregator) WithoutFlush(fn func() error) error {
+	a.flushMutex.Lock()
+	defer a.flushMutex.Unlock()
+	return fn()
+}
+
+func (a *CounterAggregator) Flush() error {
+	a.flushMutex.Lock()
+	defer a.flushMutex.Unlock()
+
+	a.mutex.Lock()
+	books := a.books
+	words := a.words
+	a.books = make(map[string]BookCounters)
+	a.words = make(map[string]int)
+	a.mutex.Unlock()
+
+	if 0 == len(books) && 0 == len(words) {
+		return nil
+	}
+
+	var booksErr, wordsErr error
+	booksErr = a.store.IncBookCounters(books)
+	failedWords := make(map[string]int)
+	for word, delta := range words {
+		err := a.store.IncSearchWord(word, delta)
+		if nil != err {
+			wordsErr = err
+			failedWords[word] = delta
+		}
+	}
+
+	err := booksErr
+	if nil == err {
+		err = wordsErr
+	}
+	if nil != booksErr {
+		a.restore(books, failedWords)
+	} else if nil != wordsErr {
+		a.restore(nil, failedWords)
+	}
+
+	a.mutex.Lock()
+	onFlush := a.onFlush
+	a.mutex.Unlock()
+	if nil == booksErr && nil != onFlush {
+		onFlush(books)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stats.LastFlushAt = time.Now().Unix()
+	if nil == booksErr {
+		for _, delta := range books {
+			a.stats.FlushedBooks += 1
+			a.stats.FlushedReads += int64(delta.Reads)
+			a.stats.FlushedSearches += int64(delta.Searches)
+			a.stats.FlushedVotes += int64(delta.Votes)
+			a.stats.FlushedOpens += int64(delta.Opens)
+		}
+	}
+	a.stats.FlushedWords += int64(len(words) - len(failedWords))
+	if nil != err {
+		a.stats.FailedFlushes += 1
+		a.stats.LastError = err.Error()
+		glog.Error("Error: fail to flush counters ", err)
+		return err
+	}
+	a.stats.Flushes += 1
+	return nil
+}
+
+func (a *CounterAggregator) Stats() CounterStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	stats := a.stats
+	stats.PendingBooks = len(a.books)
+	stats.PendingWords = len(a.words)
+	return stats
+}
+
+func (a *CounterAggregator) Close() {
+	a.closeOnce.Do(func() {
+		close(a.closeCh)
+	})
+	<-a.doneCh
+}
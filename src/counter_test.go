@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type failingCounterStore struct {
+	*MemBookStore
+	fail bool
+}
+
+func (s *failingCounterStore) IncBookCounters(deltas map[string]BookCounters) error {
+	if s.fail {
+		return errors.New("store down")
+	}
+	return s.MemBookStore.IncBookCounters(deltas)
+}
+
+func TestCounterAggregatorFlush(t *testing.T) {
+	store := newTestBookStore(t)
+	a := NewCounterAggregator(store, time.Hour, 100)
+	defer a.Close()
+
+	a.Add("1", BookCounters{Reads: 1})
+	a.Add("1", BookCounters{Reads: 2, Votes: 1})
+	a.Add("2", BookCounters{Searches: 1})
+	a.AddSearchWord("斗破")
+	a.AddSearchWord("斗破")
+
+	if p := a.Pending("1"); 3 != p.Reads || 1 != p.Votes {
+		t.Errorf("Pending: got %+v", p)
+	}
+	if book, _ := store.GetBook("1"); 10 != book.TotalReads {
+		t.Errorf("before flush: expected 10 reads, got %d", book.TotalReads)
+	}
+
+	if err := a.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	book, _ := store.GetBook("1")
+	count, _ := store.GetSearchWordCount("斗破")
+	if 13 != book.TotalReads || 4 != book.TotalVotes || 2 != count {
+		t.Errorf("after flush: got %+v, %d", book, count)
+	}
+
+	stats := a.Stats()
+	if 1 != stats.Flushes || 2 != stats.FlushedBooks || 3 != stats.FlushedReads ||
+		1 != stats.FlushedSearches || 1 != stats.FlushedVotes || 1 != stats.FlushedWords || 0 != stats.PendingBooks {
+		t.Errorf("Stats: got %+v", stats)
+	}
+}
+
+func TestCounterAggregatorSizeThreshold(t *testing.T) {
+	store := newTestBookStore(t)
+	a := NewCounterAggregator(store, time.Hour, 2)
+	defer a.Close()
+
+	a.Add("1", BookCounters{Reads: 1})
+	a.Add("2", BookCounters{Reads: 1})
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if 1 <= a.Stats().Flushes {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if book, _ := store.GetBook("2"); 31 != book.TotalReads {
+		t.Errorf("size threshold: expected flush, got %d reads", book.TotalReads)
+	}
+}
+
+func TestCounterAggregatorFailure(t *testing.T) {
+	store := &failingCounterStore{MemBookStore: newTestBookStore(t), fail: true}
+	a := NewCounterAggregator(store, time.Hour, 100)
+	defer a.Close()
+
+	a.Add("1", BookCounters{Reads: 5})
+	if err := a.Flush(); nil == err {
+		t.Fatal("Flush: expected error")
+	}
+	stats := a.Stats()
+	if 1 != stats.FailedFlushes || "" == stats.LastError || 5 != a.Pending("1").Reads {
+		t.Errorf("failed flush: expected deltas kept, got %+v", stats)
+	}
+
+	store.fail = false
+	a.Add("1", BookCounters{Reads: 1})
+	a.Close()
+	if book, _ := store.GetBook("1"); 16 != book.TotalReads {
+		t.Errorf("Close: expected flush on close, got %d reads", book.TotalReads)
+	}
+}
+
+func getStats(t *testing.T, apiKey string, v interface{}) testResp {
+	r := httptest.NewRequest("GET", "/stats", nil)
+	r.Header.Set("X-Api-Key", apiKey)
+	return serveRequest(t, StatsProc, r, v)
+}
+
+func TestStatsGet(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	doRequest(t, BookProc, "POST", "/book", `{"action":"add","key":"read","body":{"book_id":"1","client_id":"c"}}`, nil)
+
+	if resp := doRequest(t, StatsProc, "GET", "/stats", "", nil); -4 != resp.Code {
+		t.Errorf("GET /stats anonymous: expected -4, got %+v", resp)
+	}
+	if resp := getStats(t, "editor-key", nil); -5 != resp.Code {
+		t.Errorf("GET /stats as editor: expected -5, got %+v", resp)
+	}
+
+	var stats statsResp
+	resp := getStats(t, "admin-key", &stats)
+	if 0 != resp.Code || 1 != stats.Counters.PendingBooks {
+		t.Errorf("GET /stats: got %+v %+v", resp, stats)
+	}
+	mgr.FlushCounters()
+	resp = getStats(t, "admin-key", &stats)
+	if 0 != resp.Code || 1 != stats.Counters.FlushedReads || 0 != stats.Counters.PendingBooks {
+		t.Errorf("GET /stats after flush: got %+v %+v", resp, stats)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type ContentExtractor interface {
+	Extract(page string, spec *ContentSpecCfg) ([]string, error)
+}
+
+type ContentExtractorFunc func(page string, spec *ContentSpecCfg) ([]string, error)
+
+func (f ContentExtractorFunc) Extract(page string, spec *ContentSpecCfg) ([]string, error) {
+	return f(page, spec)
+}
+
+var contentExtractors = make(map[string]ContentExtractor)
+var contentExtractorsMutex sync.RWMutex
+
+func RegisterContentExtractor(ptype string, extractor ContentExtractor) {
+	contentExtractorsMutex.Lock()
+	defer contentExtractorsMutex.Unlock()
+	contentExtractors[ptype] = extractor
+}
+
+func findContentExtractor(ptype string) ContentExtractor {
+	contentExtractorsMutex.RLock()
+	defer contentExtractorsMutex.RUnlock()
+	return contentExtractors[ptype]
+}
+
+func init() {
+	RegisterContentExtractor("start_end", ContentExtractorFunc(extractStartEnd))
+	RegisterContentExtractor("segment", ContentExtractorFunc(extractSegment))
+	RegisterContentExtractor("regex", ContentExtractorFunc(extractRegex))
+	RegisterContentExtractor("css_selector", ContentExtractorFunc(extractCSSSelector))
+}
+
+var contentRegexps sync.Map
+
+func compileContentRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := contentRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if nil != err {
+		return nil, err
+	}
+	contentRegexps.Store(pattern, re)
+	return re, nil
+}
+
+func extractRegex(page string, spec *ContentSpecCfg) ([]string, error) {
+	if "" == spec.Pattern {
+		return nil, errors.New("Invalid content pattern")
+	}
+	re, err := compileContentRegexp(spec.Pattern)
+	if nil != err {
+		return nil, err
+	}
+
+	paragraphs := make([]string, 0)
+	for _, match := range re.FindAllStringSubmatch(page, -1) {
+		text := match[0]
+		if 1 < len(match) {
+			text = strings.Join(match[1:], "\n")
+		}
+		paragraphs = append(paragraphs, cleanParagraphs(text)...)
+	}
+	if 0 == len(paragraphs) {
+		return nil, errors.New("Chapter content not found")
+	}
+	return paragraphs, nil
+}
+
+func extractCSSSelector(page string, spec *ContentSpecCfg) ([]string, error) {
+	if "" == spec.Selector {
+		return nil, errors.New("Invalid content selector")
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if nil != err {
+		return nil, err
+	}
+
+	paragraphs := make([]string, 0)
+	doc.Find(spec.Selector).Each(func(i int, sel *goquery.Selection) {
+		text, err := sel.Html()
+		if nil == err {
+			paragraphs = append(paragraphs, cleanParagraphs(text)...)
+		}
+	})
+	if 0 == len(paragraphs) {
+		return nil, errors.New("Chapter content not found")
+	}
+	return paragraphs, nil
+}
+
+func validateContentCleanup(rules []ContentCleanupCfg) error {
+	for _, rule := range rules {
+		switch rule.Type {
+		case "remove_line", "replace":
+			if "" == rule.Pattern {
+				return errors.New("Empty pattern of content cleanup " + rule.Type)
+			}
+			re, err := compileContentRegexp(rule.Pattern)
+			if nil != err {
+				return err
+			}
+			if re.MatchString("") {
+				return errors.New("Content cleanup pattern matches everything: " + rule.Pattern)
+			}
+		case "strip_tags":
+		default:
+			return errors.New("Unsupported content cleanup " + rule.Type)
+		}
+	}
+	return nil
+}
+
+func cleanupParagraphs(paragraphs []string, rules []ContentCleanupCfg) ([]string, error) {
+	for _, rule := range rules {
+		var re *regexp.Regexp
+		var err error
+		if "" != rule.Pattern {
+			re, err = compileContentRegexp(rule.Pattern)
+			if nil != err {
+				return nil, err
+			}
+		}
+
+		cleaned := make([]string, 0, len(paragraphs))
+		for _, p := range paragraphs {
+			switch rule.Type {
+			case "remove_line":
+				if nil != re && re.MatchString(p) {
+					p = ""
+				}
+			case "replace":
+				if nil != re {
+					p = re.ReplaceAllString(p, rule.Replace)
+				}
+			case "strip_tags":
+				p = contentTagRegexp.ReplaceAllString(p, "")
+			default:
+				return nil, errors.New("Unsupported content cleanup " + rule.Type)
+			}
+			p = strings.TrimSpace(p)
+			if "" != p {
+				cleaned = append(cleaned, p)
+			}
+		}
+		paragraphs = cleaned
+	}
+	return paragraphs, nil
+}
+
+func extractContent(page string, spec *ContentSpecCfg) ([]string, error) {
+	extractor := findContentExtractor(spec.PType)
+	if nil == extractor {
+		return nil, errors.New("Unsupported content ptype " + spec.PType)
+	}
+	paragraphs, err := extractor.Extract(page, spec)
+	if nil != err {
+		return nil, err
+	}
+	return cleanupParagraphs(paragraphs, spec.Cleanup)
+}
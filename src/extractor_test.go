@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+const testSelectorPage = `<html><body>
+<div class="read-content"><p>第一段</p><p>请记住本站域名 www.example.com</p>
+<p>第二段<br>第三段</p></div>
+<div class="ad">广告</div>
+</body></html>`
+
+func TestExtractRegex(t *testing.T) {
+	spec := ContentSpecCfg{PType: "regex", Pattern: `(?s)<div class="read-content">(.*?)</div>`}
+	paragraphs, err := extractContent(testSelectorPage, &spec)
+	if nil != err || !equalStrings(paragraphs, "第一段", "请记住本站域名 www.example.com", "第二段", "第三段") {
+		t.Errorf("regex: got %q, %v", paragraphs, err)
+	}
+
+	spec.Pattern = "("
+	if _, err := extractContent(testSelectorPage, &spec); nil == err {
+		t.Error("regex: expected error for invalid pattern")
+	}
+}
+
+func TestExtractCSSSelector(t *testing.T) {
+	spec := ContentSpecCfg{PType: "css_selector", Selector: "div.read-content p"}
+	paragraphs, err := extractContent(testSelectorPage, &spec)
+	if nil != err || !equalStrings(paragraphs, "第一段", "请记住本站域名 www.example.com", "第二段", "第三段") {
+		t.Errorf("css_selector: got %q, %v", paragraphs, err)
+	}
+
+	spec.Selector = "div.missing"
+	if _, err := extractContent(testSelectorPage, &spec); nil == err {
+		t.Error("css_selector: expected error for missing content")
+	}
+}
+
+func TestContentCleanup(t *testing.T) {
+	spec := ContentSpecCfg{PType: "css_selector", Selector: "div.read-content p", Cleanup: []ContentCleanupCfg{
+		{Type: "remove_line", Pattern: `www\.example\.com`},
+		{Type: "replace", Pattern: "段", Replace: "节"},
+	}}
+	paragraphs, err := extractContent(testSelectorPage, &spec)
+	if nil != err || !equalStrings(paragraphs, "第一节", "第二节", "第三节") {
+		t.Errorf("cleanup: got %q, %v", paragraphs, err)
+	}
+
+	paragraphs, err = cleanupParagraphs([]string{"<a href=\"x\">正文</a>", "<br>"},
+		[]ContentCleanupCfg{{Type: "strip_tags"}})
+	if nil != err || !equalStrings(paragraphs, "正文") {
+		t.Errorf("strip_tags: got %q, %v", paragraphs, err)
+	}
+
+	if _, err := cleanupParagraphs([]string{"a"}, []ContentCleanupCfg{{Type: "unknown"}}); nil == err {
+		t.Error("cleanup: expected error for unknown type")
+	}
+
+	valid := []ContentCleanupCfg{{Type: "remove_line", Pattern: `59xs\.com`}, {Type: "replace", Pattern: "&nbsp;"},
+		{Type: "strip_tags"}}
+	if err := validateContentCleanup(valid); nil != err {
+		t.Errorf("validateContentCleanup: got %v", err)
+	}
+	for _, rule := range []ContentCleanupCfg{{Type: "remove_line"}, {Type: "replace", Pattern: "("},
+		{Type: "remove_line", Pattern: ".*"}, {Type: "unknown"}} {
+		if err := validateContentCleanup([]ContentCleanupCfg{rule}); nil == err {
+			t.Errorf("validateContentCleanup(%+v): expected error", rule)
+		}
+	}
+}
+
+func TestRegisterContentExtractor(t *testing.T) {
+	RegisterContentExtractor("test_raw", ContentExtractorFunc(func(page string, spec *ContentSpecCfg) ([]string, error) {
+		return []string{page}, nil
+	}))
+	paragraphs, err := extractContent("raw", &ContentSpecCfg{PType: "test_raw"})
+	if nil != err || !equalStrings(paragraphs, "raw") {
+		t.Errorf("registered extractor: got %q, %v", paragraphs, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+const (
+	homeCachePrefix = "home:"
+	defaultHomeSize = 6
+)
+
+var defaultHomeLayout = []HomeSectionCfg{
+	{Title: "精品推荐", List: "fprecommend"},
+	{Title: "女生推荐", List: "girlrecommend", Gender: "girl"},
+	{Title: "主编推荐", List: "directorrecommend"},
+	{Title: "人气榜", List: "reads"},
+}
+
+type HomeSection struct {
+	Title string  `json:"title"`
+	List  string  `json:"list"`
+	Books []*Book `json:"books"`
+}
+
+type HomeFeed struct {
+	Gender   string         `json:"gender"`
+	Sections []*HomeSection `json:"sections"`
+}
+
+func homeLayout() []HomeSectionCfg {
+	if 0 == len(cfg.Home.Sections) {
+		return defaultHomeLayout
+	}
+	return cfg.Home.Sections
+}
+
+// Anything but girl gets the default feed, so clients can't fan out cache keys.
+func homeGender(gender string) string {
+	if "girl" == gender {
+		return gender
+	}
+	return "default"
+}
+
+func homeCacheKey(gender string) string {
+	return homeCachePrefix + gender
+}
+
+func (mgr *BookMgr) buildHome(gender string) (*HomeFeed, error) {
+	feed := HomeFeed{Gender: gender, Sections: make([]*HomeSection, 0)}
+	for _, section := range homeLayout() {
+		if "" != section.Gender && gender != section.Gender {
+			continue
+		}
+		books, err := mgr.queryBooksList(section.List, gender, false, 0)
+		if nil != err {
+			return nil, err
+		}
+		size := section.Size
+		if 0 >= size {
+			size = defaultHomeSize
+		}
+		if size < len(books) {
+			books = books[:size]
+		}
+		feed.Sections = append(feed.Sections, &HomeSection{Title: section.Title, List: section.List, Books: books})
+	}
+	return &feed, nil
+}
+
+// QueryHome returns every section of the home screen in one go. The feed is
+// cached as a whole per gender and dropped when a recommendation list changes.
+func (mgr *BookMgr) QueryHome(gender string) (*HomeFeed, error) {
+	gender = homeGender(gender)
+	key := homeCacheKey(gender)
+	var feed HomeFeed
+	if cacheGetJSON(mgr.cache, key, &feed) {
+		return &feed, nil
+	}
+
+	built, err := mgr.buildHome(gender)
+	if nil != err {
+		return nil, err
+	}
+	cacheSetJSON(mgr.cache, key, built, cacheTTL(cfg.Cache.HomeTTL, defaultHomeTTL))
+	return built, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func homeLists(feed *HomeFeed) []string {
+	lists := make([]string, 0, len(feed.Sections))
+	for _, section := range feed.Sections {
+		lists = append(lists, section.List)
+	}
+	return lists
+}
+
+func TestHomeLayoutByGender(t *testing.T) {
+	setTestBookMgr(t)
+	old := cfg.Home
+	cfg.Home = HomeCfg{Sections: []HomeSectionCfg{
+		{Title: "精品推荐", List: "fprecommend"},
+		{Title: "女生推荐", List: "girlrecommend", Gender: "girl"},
+		{Title: "人气榜", List: "reads", Size: 2},
+	}}
+	defer func() {
+		cfg.Home = old
+	}()
+	mgr.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "girlrecommend", "books": fpBooks("3")})
+
+	var feed HomeFeed
+	resp := doRequest(t, HomeProc, "GET", "/home", "", &feed)
+	if 0 != resp.Code || !equalStrings(homeLists(&feed), "fprecommend", "reads") ||
+		!equalIds(feed.Sections[1].Books, "2", "3") || "人气榜" != feed.Sections[1].Title {
+		t.Errorf("GET /home: got %+v %+v", resp, feed)
+	}
+
+	resp = doRequest(t, HomeProc, "GET", "/home?g=girl", "", &feed)
+	if 0 != resp.Code || !equalStrings(homeLists(&feed), "fprecommend", "girlrecommend", "reads") ||
+		!equalIds(feed.Sections[1].Books, "3") {
+		t.Errorf("GET /home?g=girl: got %+v %+v", resp, feed)
+	}
+}
+
+func TestHomeCachedAsWhole(t *testing.T) {
+	store := setTestBookMgr(t)
+	feed, err := mgr.QueryHome("default")
+	if nil != err || 0 != len(feed.Sections[0].Books) {
+		t.Fatalf("QueryHome: got %+v %v", feed, err)
+	}
+
+	// Rankings come from the cache until it expires ...
+	store.AddBook(&Book{Id: "4", Name: "新书", TotalReads: 100})
+	feed, _ = mgr.QueryHome("default")
+	if ids := bookIds(feed.Sections[2].Books); 0 == len(ids) || "4" == ids[0] {
+		t.Errorf("QueryHome cached: got %v", ids)
+	}
+
+	// Unknown genders share the default feed.
+	feed, _ = mgr.QueryHome("xyz")
+	if ids := bookIds(feed.Sections[2].Books); "default" != feed.Gender || 0 == len(ids) || "4" == ids[0] {
+		t.Errorf("QueryHome(xyz): got %s %v", feed.Gender, ids)
+	}
+
+	// ... while a list change drops the whole feed.
+	mgr.SetBooks(systemAdmin, "", map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("1")})
+	feed, _ = mgr.QueryHome("default")
+	if !equalIds(feed.Sections[0].Books, "1") || "4" != feed.Sections[2].Books[0].Id {
+		t.Errorf("QueryHome after SetBooks: got %v %v", bookIds(feed.Sections[0].Books),
+			bookIds(feed.Sections[2].Books))
+	}
+}
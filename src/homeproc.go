@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+)
+
+func homeGet(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	gender := "default"
+	if 0 < len(r.Form["g"]) {
+		gender = r.Form["g"][0]
+	}
+
+	feed, err := mgr.QueryHome(gender)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", feed)
+}
+
+func HomeProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		homeGet(w, r)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var hostileInputs = []string{
+	"'",
+	"\\'",
+	"' or '1'='1",
+	"'; drop table books_table; --",
+	"1' union select * from search_words_table -- ",
+	"%' or 1=1 or '%'='",
+	"\" or \"\"=\"",
+	"`x`; delete from `search_words_table`",
+}
+
+func assertNoHostileSql(t *testing.T, d *recordDriver, input string) {
+	for _, stmt := range d.recorded() {
+		if strings.Contains(stmt.query, input) {
+			t.Errorf("input %q spliced into sql: %s", input, stmt.query)
+		}
+	}
+}
+
+func TestHostileBooksGet(t *testing.T) {
+	for _, input := range hostileInputs {
+		store, d := newRecordBookStore(t)
+		mgr, _ = NewBookMgr(store, nil)
+		c := url.QueryEscape(input)
+		for _, target := range []string{
+			"/books?a=l&c=" + c,
+			"/books?a=s&c=" + c,
+			"/books?a=c&c=" + c + "&g=" + c,
+		} {
+			resp := doRequest(t, BookMgrsProc, "GET", target, "", nil)
+			if 0 != resp.Code {
+				t.Errorf("GET %s: got %+v", target, resp)
+			}
+		}
+		assertNoHostileSql(t, d, input)
+	}
+}
+
+func TestHostileBooksPost(t *testing.T) {
+	defer setTestAdminKeys()()
+	for _, input := range hostileInputs {
+		store, d := newRecordBookStore(t)
+		d.setResult("select coalesce(max(version), 0) from `recommend_versions` where clazz=? for update",
+			[]driver.Value{int64(0)})
+		mgr, _ = NewBookMgr(store, nil)
+		body, _ := jsonMarshal(apiPostP{Action: "set", Body: map[string]interface{}{
+			"clazz": "directorrecommend",
+			"books": []recommendBook{{Id: input, RWords: input, RUser: input}},
+		}})
+		resp := doAdminRequest(t, BookMgrsProc, "/books", string(body), "admin-key")
+		if 0 != resp.Code {
+			t.Errorf("POST /books: got %+v", resp)
+		}
+
+		body, _ = jsonMarshal(apiPostP{Action: "set", Body: map[string]interface{}{
+			"clazz": input,
+			"books": []recommendBook{{Id: "1"}},
+		}})
+		resp = doAdminRequest(t, BookMgrsProc, "/books", string(body), "admin-key")
+		if 0 == resp.Code {
+			t.Errorf("POST /books with list %q: expected error", input)
+		}
+		assertNoHostileSql(t, d, input)
+	}
+}
+
+func TestHostileBook(t *testing.T) {
+	for _, input := range hostileInputs {
+		store, d := newRecordBookStore(t)
+		mgr, _ = NewBookMgr(store, nil)
+		body, _ := jsonMarshal(apiPostP{Action: "add", Key: "read", Body: bookReqBodyBaseP{
+			BookId: input, ClientId: input}})
+		resp := doRequest(t, BookProc, "POST", "/book", string(body), nil)
+		if -3 != resp.Code {
+			t.Errorf("POST /book read %q: expected -3, got %+v", input, resp)
+		}
+
+		c := url.QueryEscape(input)
+		doRequest(t, BookProc, "GET", "/book?a=ch&id="+c+"&n="+c+"&au="+c, "", nil)
+		assertNoHostileSql(t, d, input)
+	}
+}
+
+func TestHostileSearchMemStore(t *testing.T) {
+	setTestBookMgr(t)
+	for _, input := range hostileInputs {
+		var search booksSearchResp
+		resp := doRequest(t, BookMgrsProc, "GET", "/books?a=s&c="+url.QueryEscape(input), "", &search)
+		if 0 != resp.Code || 0 != len(search.Books) {
+			t.Errorf("GET /books?a=s&c=%s: got %+v %v", input, resp, bookIds(search.Books))
+		}
+	}
+}
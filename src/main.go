@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"kkt.com/glog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func serveBooks(w http.ResponseWriter, r *http.Request) {
@@ -13,17 +18,89 @@ func serveBook(w http.ResponseWriter, r *http.Request) {
 	BookProc(w, r)
 }
 
+func serveChapter(w http.ResponseWriter, r *http.Request) {
+	ChapterProc(w, r)
+}
+
+func serveShelf(w http.ResponseWriter, r *http.Request) {
+	ShelfProc(w, r)
+}
+
+func serveProgress(w http.ResponseWriter, r *http.Request) {
+	ProgressProc(w, r)
+}
+
+func serveAccount(w http.ResponseWriter, r *http.Request) {
+	AccountProc(w, r)
+}
+
+func serveHome(w http.ResponseWriter, r *http.Request) {
+	HomeProc(w, r)
+}
+
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	StatsProc(w, r)
+}
+
+func waitShutdown(server *http.Server, done chan struct{}) {
+	defer close(done)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if nil != err {
+		glog.Error(err)
+	}
+}
+
 func main() {
 	ConfigInitialize()
-	err := DBOpen(&cfg.Mysql)
+	err := ValidateConfig()
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	store, err := NewMysqlBookStore(&cfg.Mysql)
 	if nil != err {
 		glog.Error(err)
 		return
 	}
+	defer store.Close()
+
+	if "" != cfgMigration {
+		err = RunMigration(store, cfgMigration)
+		if nil != err {
+			glog.Error(err)
+		}
+		return
+	}
+
+	mgr, err = NewBookMgr(store, NewCache(&cfg.Cache))
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	defer mgr.Close()
+
+	http.HandleFunc("/home", serveHome)
 	http.HandleFunc("/books", serveBooks)
 	http.HandleFunc("/book", serveBook)
-	for {
-		http.ListenAndServe(":8999", nil)
+	http.HandleFunc("/chapter", serveChapter)
+	http.HandleFunc("/shelf", serveShelf)
+	http.HandleFunc("/progress", serveProgress)
+	http.HandleFunc("/account", serveAccount)
+	http.HandleFunc("/stats", serveStats)
+
+	server := &http.Server{Addr: ":8999"}
+	done := make(chan struct{})
+	go waitShutdown(server, done)
+	err = server.ListenAndServe()
+	if http.ErrServerClosed != err {
+		glog.Error(err)
+		return
 	}
-	DBClose()
+	<-done
 }
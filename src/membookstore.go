@@ -0,0 +1,850 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memReaderKey struct {
+	bookId   string
+	clientId string
+	day      string
+}
+
+type memContentKey struct {
+	bookId    string
+	chapterId string
+}
+
+type MemBookStore struct {
+	mutex       sync.RWMutex
+	books       []*Book
+	recommends  map[string][]recommendBook
+	chapters    map[string][]*Chapter
+	contents    map[memContentKey]*StoredChapterContent
+	searchWords map[string]int
+	votes       []*Vote
+	readers     map[memReaderKey]bool
+	opens       map[string]int
+	shelves     map[string][]*ShelfEntry
+	progresses  map[string]*ReadingProgress
+	accounts    []*Account
+	clients     map[string]int64
+	secrets     map[string]string
+	versions    []*RecommendVersion
+	schedules   []*RecommendSchedule
+}
+
+func NewMemBookStore() (*MemBookStore, error) {
+	var s MemBookStore
+	s.books = make([]*Book, 0)
+	s.recommends = make(map[string][]recommendBook)
+	s.chapters = make(map[string][]*Chapter)
+	s.contents = make(map[memContentKey]*StoredChapterContent)
+	s.searchWords = make(map[string]int)
+	s.readers = make(map[memReaderKey]bool)
+	s.opens = make(map[string]int)
+	s.shelves = make(map[string][]*ShelfEntry)
+	s.progresses = make(map[string]*ReadingProgress)
+	s.clients = make(map[string]int64)
+	s.secrets = make(map[string]string)
+	return &s, nil
+}
+
+func (s *MemBookStore) AddBook(book *Book) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, b := range s.books {
+		if b.Id == book.Id {
+			s.books[i] = book
+			return
+		}
+	}
+	s.books = append(s.books, book)
+}
+
+func (s *MemBookStore) AddBookChapters(bookId string, chapters []*Chapter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.chapters[bookId] = append(s.chapters[bookId], chapters...)
+}
+
+func (s *MemBookStore) findBook(id string) *Book {
+	for _, book := range s.books {
+		if book.Id == id {
+			return book
+		}
+	}
+	return nil
+}
+
+func copyBook(book *Book) *Book {
+	b := *book
+	return &b
+}
+
+func memMatchFilter(book *Book, filter BookFilter) bool {
+	if "girl" == filter.Gender && "girl" != book.Gender {
+		return false
+	}
+	if filter.Finished && !book.Finished {
+		return false
+	}
+	if "" != filter.Clazz && filter.Clazz != book.Class {
+		return false
+	}
+	return true
+}
+
+func memOrderValue(book *Book, order string) int {
+	switch order {
+	case orderByVotes:
+		return book.TotalVotes
+	case orderByReads:
+		return book.TotalReads
+	case orderBySearches:
+		return book.TotalSearches
+	case orderByChars:
+		return book.TotalChars
+	}
+	return book.Score
+}
+
+func memPage(books []*Book, offset int, limit int) []*Book {
+	if offset >= len(books) {
+		return make([]*Book, 0)
+	}
+	end := offset + limit
+	if end > len(books) {
+		end = len(books)
+	}
+	return books[offset:end]
+}
+
+func (s *MemBookStore) filterBooks(match func(book *Book) bool) []*Book {
+	books := make([]*Book, 0)
+	for _, book := range s.books {
+		if match(book) {
+			books = append(books, copyBook(book))
+		}
+	}
+	return books
+}
+
+func (s *MemBookStore) QueryBooks(filter BookFilter, order string, offset int, limit int) ([]*Book, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	books := s.filterBooks(func(book *Book) bool {
+		return memMatchFilter(book, filter)
+	})
+	sort.SliceStable(books, func(i, j int) bool {
+		if orderById == order {
+			return books[i].Id > books[j].Id
+		}
+		return memOrderValue(books[i], order) > memOrderValue(books[j], order)
+	})
+	return memPage(books, offset, limit), nil
+}
+
+func (s *MemBookStore) CountBooks(filter BookFilter) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	count := 0
+	for _, book := range s.books {
+		if memMatchFilter(book, filter) {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func (s *MemBookStore) QueryClazzs(filter BookFilter) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	clazzs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, book := range s.books {
+		if !memMatchFilter(book, filter) || seen[book.Class] {
+			continue
+		}
+		seen[book.Class] = true
+		clazzs = append(clazzs, book.Class)
+	}
+	return clazzs, nil
+}
+
+func (s *MemBookStore) GetBook(id string) (*Book, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	book := s.findBook(id)
+	if nil == book {
+		return nil, nil
+	}
+	return copyBook(book), nil
+}
+
+func (s *MemBookStore) QueryRecommendBooks(table string, notes bool, filter BookFilter) ([]*Book, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	books := make([]*Book, 0)
+	for _, r := range s.recommends[table] {
+		book := s.findBook(r.Id)
+		if nil == book || !memMatchFilter(book, BookFilter{Gender: filter.Gender, Finished: filter.Finished}) {
+			continue
+		}
+		book = copyBook(book)
+		if notes {
+			book.RWords = r.RWords
+			book.RUser = r.RUser
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+func (s *MemBookStore) SetRecommendBooks(table string, notes bool, books []recommendBook, version *RecommendVersion) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	recommends := make([]recommendBook, 0, len(books))
+	seen := make(map[string]bool, len(books))
+	for _, book := range books {
+		if seen[book.Id] {
+			continue
+		}
+		seen[book.Id] = true
+		if !notes {
+			book.RWords = ""
+			book.RUser = ""
+		}
+		recommends = append(recommends, book)
+	}
+	s.recommends[table] = recommends
+
+	if nil == version {
+		return nil
+	}
+	version.Id = int64(len(s.versions) + 1)
+	version.Version = 1
+	for _, v := range s.versions {
+		if version.Clazz == v.Clazz && version.Version <= v.Version {
+			version.Version = v.Version + 1
+		}
+	}
+	s.versions = append(s.versions, copyRecommendVersion(version))
+	return nil
+}
+
+func copyRecommendVersion(version *RecommendVersion) *RecommendVersion {
+	v := *version
+	v.Books = append([]recommendBook{}, version.Books...)
+	return &v
+}
+
+func (s *MemBookStore) QueryRecommendVersions(clazz string, offset int, limit int) ([]*RecommendVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	versions := make([]*RecommendVersion, 0)
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if clazz == s.versions[i].Clazz {
+			versions = append(versions, copyRecommendVersion(s.versions[i]))
+		}
+	}
+	if offset >= len(versions) {
+		return make([]*RecommendVersion, 0), nil
+	}
+	versions = versions[offset:]
+	if limit < len(versions) {
+		versions = versions[:limit]
+	}
+	return versions, nil
+}
+
+func (s *MemBookStore) GetRecommendVersion(clazz string, version int) (*RecommendVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, v := range s.versions {
+		if clazz == v.Clazz && version == v.Version {
+			return copyRecommendVersion(v), nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemBookStore) IsRecommendBook(table string, bookId string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, r := range s.recommends[table] {
+		if r.Id == bookId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func copyRecommendSchedule(schedule *RecommendSchedule) *RecommendSchedule {
+	v := *schedule
+	v.Books = append([]recommendBook{}, schedule.Books...)
+	return &v
+}
+
+func (s *MemBookStore) AddRecommendSchedule(schedule *RecommendSchedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	schedule.Id = int64(len(s.schedules) + 1)
+	s.schedules = append(s.schedules, copyRecommendSchedule(schedule))
+	return nil
+}
+
+func (s *MemBookStore) GetRecommendSchedule(id int64) (*RecommendSchedule, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, schedule := range s.schedules {
+		if id == schedule.Id {
+			return copyRecommendSchedule(schedule), nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemBookStore) UpdateRecommendSchedule(schedule *RecommendSchedule, fromState string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, v := range s.schedules {
+		if schedule.Id == v.Id && fromState == v.State {
+			v.State = schedule.State
+			v.Version = schedule.Version
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func scheduleDueAt(schedule *RecommendSchedule) int64 {
+	if schedulePending == schedule.State {
+		return schedule.PublishAt
+	}
+	return schedule.ExpireAt
+}
+
+func (s *MemBookStore) QueryDueRecommendSchedules(now int64) ([]*RecommendSchedule, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	schedules := make([]*RecommendSchedule, 0)
+	for _, schedule := range s.schedules {
+		due := schedulePending == schedule.State && schedule.PublishAt <= now
+		due = due || (schedulePublished == schedule.State && 0 < schedule.ExpireAt && schedule.ExpireAt <= now)
+		if due {
+			schedules = append(schedules, copyRecommendSchedule(schedule))
+		}
+	}
+	sort.SliceStable(schedules, func(i, j int) bool {
+		return scheduleDueAt(schedules[i]) < scheduleDueAt(schedules[j])
+	})
+	return schedules, nil
+}
+
+func (s *MemBookStore) QueryRecommendSchedules(clazz string, offset int, limit int) ([]*RecommendSchedule, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	schedules := make([]*RecommendSchedule, 0)
+	for i := len(s.schedules) - 1; i >= 0; i-- {
+		if clazz == s.schedules[i].Clazz {
+			schedules = append(schedules, copyRecommendSchedule(s.schedules[i]))
+		}
+	}
+	if offset >= len(schedules) {
+		return make([]*RecommendSchedule, 0), nil
+	}
+	schedules = schedules[offset:]
+	if limit < len(schedules) {
+		schedules = schedules[:limit]
+	}
+	return schedules, nil
+}
+
+func memLikeMatch(value string, key string) bool {
+	for _, c := range key {
+		i := strings.IndexRune(value, c)
+		if 0 > i {
+			return false
+		}
+		value = value[i+len(string(c)):]
+	}
+	return true
+}
+
+func (s *MemBookStore) searchBooks(key string) []*Book {
+	blank := "" == strings.TrimSpace(key)
+	books := s.filterBooks(func(book *Book) bool {
+		return blank || memLikeMatch(book.Author, key) || memLikeMatch(book.Name, key) ||
+			memLikeMatch(book.Class, key)
+	})
+	sort.SliceStable(books, func(i, j int) bool {
+		return books[i].Score > books[j].Score
+	})
+	return books
+}
+
+func (s *MemBookStore) SearchBooks(key string, offset int, limit int) ([]*Book, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return memPage(s.searchBooks(key), offset, limit), nil
+}
+
+func (s *MemBookStore) CountSearchBooks(key string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.searchBooks(key)), nil
+}
+
+func (s *MemBookStore) bookChapters(bookId string, afterNativeId int) []*Chapter {
+	chapters := make([]*Chapter, 0)
+	for _, chapter := range s.chapters[bookId] {
+		if chapter.NativeId <= afterNativeId {
+			continue
+		}
+		c := *chapter
+		chapters = append(chapters, &c)
+	}
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].NativeId < chapters[j].NativeId
+	})
+	return chapters
+}
+
+func (s *MemBookStore) GetBookChapters(bookId string) ([]*Chapter, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.bookChapters(bookId, -1), nil
+}
+
+func (s *MemBookStore) QueryBookChapters(bookId string, afterNativeId int, offset int, limit int) ([]*Chapter, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	chapters := s.bookChapters(bookId, afterNativeId)
+	if offset >= len(chapters) {
+		return make([]*Chapter, 0), nil
+	}
+	chapters = chapters[offset:]
+	if 0 < limit && limit < len(chapters) {
+		chapters = chapters[:limit]
+	}
+	return chapters, nil
+}
+
+func (s *MemBookStore) CountBookChapters(bookId string, afterNativeId int) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.bookChapters(bookId, afterNativeId)), nil
+}
+
+func (s *MemBookStore) GetLatestBookChapter(bookId string) (*Chapter, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	chapters := s.bookChapters(bookId, -1)
+	if 0 == len(chapters) {
+		return nil, nil
+	}
+	return chapters[len(chapters)-1], nil
+}
+
+func (s *MemBookStore) GetChapterContent(bookId string, chapterId string) (*StoredChapterContent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	content, ok := s.contents[memContentKey{bookId, chapterId}]
+	if !ok {
+		return nil, nil
+	}
+	c := *content
+	c.Paragraphs = append([]string{}, content.Paragraphs...)
+	return &c, nil
+}
+
+func (s *MemBookStore) SaveChapterContent(content *StoredChapterContent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c := *content
+	c.Paragraphs = append([]string{}, content.Paragraphs...)
+	s.contents[memContentKey{content.BookId, content.ChapterId}] = &c
+	return nil
+}
+
+func (s *MemBookStore) IncBookCounters(deltas map[string]BookCounters) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, delta := range deltas {
+		if book := s.findBook(id); nil != book {
+			book.TotalReads += delta.Reads
+			book.TotalSearches += delta.Searches
+			book.TotalVotes += delta.Votes
+		}
+		s.opens[id] += delta.Opens
+	}
+	return nil
+}
+
+func (s *MemBookStore) AddBookReader(bookId string, clientId string, day string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := memReaderKey{bookId, clientId, day}
+	if s.readers[key] {
+		return false, nil
+	}
+	s.readers[key] = true
+	return true, nil
+}
+
+func (s *MemBookStore) DeleteBookReaders(beforeDay string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.readers {
+		if key.day < beforeDay {
+			delete(s.readers, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemBookStore) GetBookOpens(bookId string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.opens[bookId], nil
+}
+
+func (s *MemBookStore) findShelfEntry(clientId string, bookId string) (int, *ShelfEntry) {
+	for i, entry := range s.shelves[clientId] {
+		if bookId == entry.BookId {
+			return i, entry
+		}
+	}
+	return -1, nil
+}
+
+func (s *MemBookStore) AddShelfBook(entry *ShelfEntry) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, e := s.findShelfEntry(entry.ClientId, entry.BookId); nil != e {
+		return false, nil
+	}
+	e := *entry
+	s.shelves[entry.ClientId] = append(s.shelves[entry.ClientId], &e)
+	return true, nil
+}
+
+func (s *MemBookStore) RemoveShelfBook(clientId string, bookId string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i, _ := s.findShelfEntry(clientId, bookId)
+	if 0 > i {
+		return false, nil
+	}
+	shelf := s.shelves[clientId]
+	s.shelves[clientId] = append(shelf[:i:i], shelf[i+1:]...)
+	return true, nil
+}
+
+func (s *MemBookStore) QueryShelfBooks(clientId string) ([]*ShelfEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entries := make([]*ShelfEntry, 0, len(s.shelves[clientId]))
+	for _, entry := range s.shelves[clientId] {
+		e := *entry
+		entries = append(entries, &e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Position < entries[j].Position
+	})
+	return entries, nil
+}
+
+func (s *MemBookStore) SetShelfPositions(clientId string, bookIds []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for position, bookId := range bookIds {
+		if _, entry := s.findShelfEntry(clientId, bookId); nil != entry {
+			entry.Position = position
+		}
+	}
+	return nil
+}
+
+func (s *MemBookStore) MarkShelfBookOpened(clientId string, bookId string, seenNativeId int, openedAt int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, entry := s.findShelfEntry(clientId, bookId); nil != entry {
+		entry.SeenNativeId = seenNativeId
+		entry.OpenedAt = openedAt
+	}
+	return nil
+}
+
+func (s *MemBookStore) SaveReadingProgress(progress *ReadingProgress) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := progress.ClientId + "/" + progress.BookId
+	if old, ok := s.progresses[key]; ok && old.UpdatedAt > progress.UpdatedAt {
+		return false, nil
+	}
+	p := *progress
+	s.progresses[key] = &p
+	return true, nil
+}
+
+func (s *MemBookStore) GetReadingProgress(clientId string, bookId string) (*ReadingProgress, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	progress, ok := s.progresses[clientId+"/"+bookId]
+	if !ok {
+		return nil, nil
+	}
+	p := *progress
+	return &p, nil
+}
+
+func (s *MemBookStore) QueryReadingProgress(clientId string, offset int, limit int) ([]*ReadingProgress, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	progresses := make([]*ReadingProgress, 0)
+	for _, progress := range s.progresses {
+		if clientId == progress.ClientId {
+			p := *progress
+			progresses = append(progresses, &p)
+		}
+	}
+	sort.Slice(progresses, func(i, j int) bool {
+		if progresses[i].UpdatedAt != progresses[j].UpdatedAt {
+			return progresses[i].UpdatedAt > progresses[j].UpdatedAt
+		}
+		return progresses[i].BookId < progresses[j].BookId
+	})
+	if offset >= len(progresses) {
+		return make([]*ReadingProgress, 0), nil
+	}
+	progresses = progresses[offset:]
+	if limit < len(progresses) {
+		progresses = progresses[:limit]
+	}
+	return progresses, nil
+}
+
+func (s *MemBookStore) AddAccount(account *Account) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, a := range s.accounts {
+		if account.Name == a.Name {
+			return errors.New("Account already exists")
+		}
+	}
+	account.Id = int64(len(s.accounts) + 1)
+	a := *account
+	s.accounts = append(s.accounts, &a)
+	return nil
+}
+
+func (s *MemBookStore) findAccount(match func(account *Account) bool) *Account {
+	for _, account := range s.accounts {
+		if match(account) {
+			a := *account
+			return &a
+		}
+	}
+	return nil
+}
+
+func (s *MemBookStore) GetAccount(id int64) (*Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.findAccount(func(account *Account) bool { return id == account.Id }), nil
+}
+
+func (s *MemBookStore) GetAccountByName(name string) (*Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.findAccount(func(account *Account) bool { return name == account.Name }), nil
+}
+
+func (s *MemBookStore) LinkClient(clientId string, accountId int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clients[clientId] = accountId
+	return nil
+}
+
+func (s *MemBookStore) SetClientSecret(clientId string, secretHash string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.secrets[clientId]; ok {
+		return false, nil
+	}
+	s.secrets[clientId] = secretHash
+	return true, nil
+}
+
+func (s *MemBookStore) GetClientSecret(clientId string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.secrets[clientId], nil
+}
+
+func (s *MemBookStore) GetClientAccount(clientId string) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.clients[clientId], nil
+}
+
+func (s *MemBookStore) QueryAccountClients(accountId int64) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	clientIds := make([]string, 0)
+	for clientId, id := range s.clients {
+		if accountId == id {
+			clientIds = append(clientIds, clientId)
+		}
+	}
+	sort.Strings(clientIds)
+	return clientIds, nil
+}
+
+func (s *MemBookStore) MoveOwnerData(from string, to string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range s.shelves[from] {
+		if _, e := s.findShelfEntry(to, entry.BookId); nil == e {
+			entry.ClientId = to
+			s.shelves[to] = append(s.shelves[to], entry)
+		}
+	}
+	delete(s.shelves, from)
+
+	for key, progress := range s.progresses {
+		if from != progress.ClientId {
+			continue
+		}
+		delete(s.progresses, key)
+		toKey := to + "/" + progress.BookId
+		if old, ok := s.progresses[toKey]; ok && old.UpdatedAt > progress.UpdatedAt {
+			continue
+		}
+		progress.ClientId = to
+		s.progresses[toKey] = progress
+	}
+
+	for key := range s.readers {
+		if from == key.clientId {
+			delete(s.readers, key)
+			s.readers[memReaderKey{key.bookId, to, key.day}] = true
+		}
+	}
+	return nil
+}
+
+func (s *MemBookStore) AddVote(vote *Vote) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	vote.Id = int64(len(s.votes) + 1)
+	v := *vote
+	s.votes = append(s.votes, &v)
+	return nil
+}
+
+func (s *MemBookStore) clientVotes(clientId string, bookId string, day string) []*Vote {
+	votes := make([]*Vote, 0)
+	for _, vote := range s.votes {
+		if vote.Revoked || clientId != vote.ClientId || day != vote.Day {
+			continue
+		}
+		if "" != bookId && bookId != vote.BookId {
+			continue
+		}
+		v := *vote
+		votes = append(votes, &v)
+	}
+	return votes
+}
+
+func (s *MemBookStore) CountClientVotes(clientId string, bookId string, day string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.clientVotes(clientId, bookId, day)), nil
+}
+
+func (s *MemBookStore) QueryClientVotes(clientId string, bookId string, day string) ([]*Vote, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.clientVotes(clientId, bookId, day), nil
+}
+
+func (s *MemBookStore) QueryBookVotes(bookId string, offset int, limit int) ([]*Vote, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	votes := make([]*Vote, 0)
+	for i := len(s.votes) - 1; i >= 0; i-- {
+		if bookId == s.votes[i].BookId {
+			v := *s.votes[i]
+			votes = append(votes, &v)
+		}
+	}
+	if offset >= len(votes) {
+		return make([]*Vote, 0), nil
+	}
+	votes = votes[offset:]
+	if limit < len(votes) {
+		votes = votes[:limit]
+	}
+	return votes, nil
+}
+
+func (s *MemBookStore) RevokeVote(id int64) (*Vote, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, vote := range s.votes {
+		if id == vote.Id && !vote.Revoked {
+			vote.Revoked = true
+			v := *vote
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemBookStore) queryWords(desc bool, limit int) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	words := make([]string, 0, len(s.searchWords))
+	for word := range s.searchWords {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if s.searchWords[words[i]] == s.searchWords[words[j]] {
+			return words[i] < words[j]
+		}
+		return desc == (s.searchWords[words[i]] > s.searchWords[words[j]])
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	return words, nil
+}
+
+func (s *MemBookStore) QueryHotWords(limit int) ([]string, error) {
+	return s.queryWords(false, limit)
+}
+
+func (s *MemBookStore) QueryTopSearchWords(limit int) ([]string, error) {
+	return s.queryWords(true, limit)
+}
+
+func (s *MemBookStore) GetSearchWordCount(word string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.searchWords[word], nil
+}
+
+func (s *MemBookStore) IncSearchWord(word string, delta int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.searchWords[word] += delta
+	return nil
+}
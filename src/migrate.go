@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"kkt.com/glog"
+)
+
+type bookChaptersTable struct {
+	bookId string
+	table  string
+}
+
+func (s *MysqlBookStore) queryBookChaptersTables() ([]bookChaptersTable, error) {
+	tables := make([]bookChaptersTable, 0)
+	err := s.query("select id, name, author from `books_table`", func(rows *sql.Rows) error {
+		var id, name, author string
+		err := rows.Scan(&id, &name, &author)
+		if nil == err {
+			tables = append(tables, bookChaptersTable{bookId: id, table: bookChaptersKey(name, author)})
+		}
+		return err
+	})
+	return tables, err
+}
+
+func (s *MysqlBookStore) tableExists(table string) (bool, error) {
+	count := 0
+	err := s.query("select count(*) from information_schema.tables where table_schema=database() and table_name=?",
+		func(rows *sql.Rows) error {
+			return rows.Scan(&count)
+		}, table)
+	return 0 < count, err
+}
+
+func (s *MysqlBookStore) MigrateChapters() error {
+	tables, err := s.queryBookChaptersTables()
+	if nil != err {
+		return err
+	}
+
+	migrated := 0
+	for _, t := range tables {
+		exists, err := s.tableExists(t.table)
+		if nil != err {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		sqlExec := fmt.Sprintf("insert ignore into `chapters` (book_id, native_id, id, title, url, vip)"+
+			" select ?, t.* from `%s` t", t.table)
+		err = s.exec(sqlExec, t.bookId)
+		if nil != err {
+			glog.Error(err, " ", t.bookId, " ", t.table)
+			return err
+		}
+		migrated += 1
+	}
+
+	glog.Info(fmt.Sprintf("Migrated chapters of %d/%d books", migrated, len(tables)))
+	return s.migrateChapterContents(tables)
+}
+
+func (s *MysqlBookStore) migrateChapterContents(tables []bookChaptersTable) error {
+	exists, err := s.columnExists("chapter_contents", "book_key")
+	if nil != err || !exists {
+		return err
+	}
+
+	for _, t := range tables {
+		err = s.exec("update `chapter_contents` set book_key=? where book_key=?", t.bookId, t.table)
+		if nil != err {
+			glog.Error(err, " ", t.bookId, " ", t.table)
+			return err
+		}
+	}
+	err = s.exec("alter table `chapter_contents` change column `book_key` `book_id` varchar(64) not null")
+	if nil != err {
+		return err
+	}
+
+	glog.Info(fmt.Sprintf("Keyed chapter contents of %d books by book id", len(tables)))
+	return nil
+}
+
+func (s *MysqlBookStore) columnExists(table string, column string) (bool, error) {
+	count := 0
+	err := s.query("select count(*) from information_schema.columns where table_schema=database()"+
+		" and table_name=? and column_name=?", func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	}, table, column)
+	return 0 < count, err
+}
+
+func (s *MysqlBookStore) MigrateRecommendPositions(lists []RecommendListCfg) error {
+	migrated := 0
+	for _, list := range lists {
+		if !sqlIdentifier.MatchString(list.Table) {
+			continue
+		}
+		exists, err := s.columnExists(list.Table, "position")
+		if nil != err {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		err = s.exec(fmt.Sprintf("alter table `%s` add column `position` int not null default 0", list.Table))
+		if nil != err {
+			glog.Error(err, " ", list.Table)
+			return err
+		}
+		migrated += 1
+	}
+
+	glog.Info(fmt.Sprintf("Added position to %d/%d recommend lists", migrated, len(lists)))
+	return nil
+}
+
+func RunMigration(store *MysqlBookStore, name string) error {
+	switch name {
+	case "chapters":
+		return store.MigrateChapters()
+	case "positions":
+		return store.MigrateRecommendPositions(recommendLists())
+	}
+	return errors.New("Unknown migration " + name)
+}
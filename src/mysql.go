@@ -7,23 +7,28 @@ import (
 	"kkt.com/glog"
 )
 
-var db *sql.DB
+type MysqlBookStore struct {
+	db *sql.DB
+}
 
-func DBOpen(cfg *MysqlCfg) error {
+func NewMysqlBookStore(cfg *MysqlCfg) (*MysqlBookStore, error) {
 	dsn := fmt.Sprintf("%s:%s@%s(%s)/%s", cfg.User, cfg.Password, "tcp", cfg.Host, cfg.Db)
-	var err error
-	db, err = sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", dsn)
 	if nil != err {
 		glog.Error(err, dsn)
-		return err
+		return nil, err
 	}
-	return nil
+	return newMysqlBookStore(db), nil
+}
+
+func newMysqlBookStore(db *sql.DB) *MysqlBookStore {
+	return &MysqlBookStore{db: db}
 }
 
-func DBQuery(sqlExec string, scanner func(rows *sql.Rows) error) error {
+func (s *MysqlBookStore) query(sqlExec string, scanner func(rows *sql.Rows) error, args ...interface{}) error {
 	glog.Info(sqlExec, "------ Start")
 
-	rows, err := db.Query(sqlExec)
+	rows, err := s.db.Query(sqlExec, args...)
 	if nil != err {
 		glog.Error(err)
 		return err
@@ -42,11 +47,24 @@ func DBQuery(sqlExec string, scanner func(rows *sql.Rows) error) error {
 	return nil
 }
 
-func DBClose() {
-	db.Close()
+func (s *MysqlBookStore) exec(sqlExec string, args ...interface{}) error {
+	_, err := s.db.Exec(sqlExec, args...)
+	return err
 }
 
-func DBExec(sqlExec string) error {
-	_, err := db.Exec(sqlExec)
-	return err
+func (s *MysqlBookStore) transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if nil != err {
+		return err
+	}
+	err = fn(tx)
+	if nil != err {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MysqlBookStore) Close() {
+	s.db.Close()
 }
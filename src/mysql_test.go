@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordedStmt struct {
+	query string
+	args  []driver.Value
+}
+
+type recordDriver struct {
+	mutex   sync.Mutex
+	stmts   []recordedStmt
+	results map[string][][]driver.Value
+}
+
+type recordConn struct {
+	d *recordDriver
+}
+
+type recordStmt struct {
+	d     *recordDriver
+	query string
+}
+
+type recordRows struct {
+	values [][]driver.Value
+}
+
+type recordResult struct{}
+
+func (d *recordDriver) Open(name string) (driver.Conn, error) {
+	return &recordConn{d: d}, nil
+}
+
+func (d *recordDriver) record(query string, args []driver.Value) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stmts = append(d.stmts, recordedStmt{query: query, args: args})
+}
+
+func (d *recordDriver) result(query string) [][]driver.Value {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.results[query]
+}
+
+func (d *recordDriver) setResult(query string, values ...[]driver.Value) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.results[query] = values
+}
+
+func (d *recordDriver) recorded() []recordedStmt {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]recordedStmt{}, d.stmts...)
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordStmt{d: c.d, query: query}, nil
+}
+
+func (c *recordConn) Close() error {
+	return nil
+}
+
+func (c *recordConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *recordConn) Commit() error {
+	return nil
+}
+
+func (c *recordConn) Rollback() error {
+	return nil
+}
+
+func (s *recordStmt) Close() error {
+	return nil
+}
+
+func (s *recordStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.record(s.query, args)
+	return recordResult{}, nil
+}
+
+func (s *recordStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.record(s.query, args)
+	return &recordRows{values: s.d.result(s.query)}, nil
+}
+
+func (r *recordRows) Columns() []string {
+	if 0 == len(r.values) {
+		return []string{}
+	}
+	return make([]string, len(r.values[0]))
+}
+
+func (r *recordRows) Close() error {
+	return nil
+}
+
+func (r *recordRows) Next(dest []driver.Value) error {
+	if 0 == len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func (r recordResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r recordResult) RowsAffected() (int64, error) {
+	return 0, nil
+}
+
+var recordDriverOnce sync.Once
+var testRecordDriver = &recordDriver{}
+
+func newRecordBookStore(t *testing.T) (*MysqlBookStore, *recordDriver) {
+	recordDriverOnce.Do(func() {
+		sql.Register("record", testRecordDriver)
+	})
+	db, err := sql.Open("record", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	testRecordDriver.mutex.Lock()
+	testRecordDriver.stmts = nil
+	testRecordDriver.results = make(map[string][][]driver.Value)
+	testRecordDriver.mutex.Unlock()
+	return newMysqlBookStore(db), testRecordDriver
+}
+
+func TestSqlLikeEscape(t *testing.T) {
+	where, args := sqlSearchWhere("a%_\\")
+	if strings.Contains(where, "%") {
+		t.Errorf("sqlSearchWhere: pattern leaked into sql: %s", where)
+	}
+	if 3 != len(args) || `%a%\%%\_%\\%` != args[0] {
+		t.Errorf("sqlSearchWhere: got %v", args)
+	}
+	if where, args := sqlSearchWhere("  "); "" != where || 0 != len(args) {
+		t.Errorf("sqlSearchWhere(blank): got %q %v", where, args)
+	}
+}
+
+func TestSqlOrderWhitelist(t *testing.T) {
+	if "order by score desc" != sqlOrderString("id; drop table books_table") {
+		t.Error("sqlOrderString: unknown order column accepted")
+	}
+}
+
+func TestMigrateChapters(t *testing.T) {
+	store, d := newRecordBookStore(t)
+	d.setResult("select id, name, author from `books_table`",
+		[]driver.Value{"1", "斗破苍穹", "天蚕土豆"}, []driver.Value{"2", "凡人修仙传", "忘语"})
+	d.setResult("select count(*) from information_schema.tables where table_schema=database() and table_name=?",
+		[]driver.Value{int64(1)})
+
+	err := RunMigration(store, "chapters")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	inserts := make([]recordedStmt, 0)
+	for _, stmt := range d.recorded() {
+		if strings.HasPrefix(stmt.query, "insert ignore into `chapters`") {
+			inserts = append(inserts, stmt)
+		}
+	}
+	if 2 != len(inserts) {
+		t.Fatalf("MigrateChapters: expected 2 inserts, got %+v", inserts)
+	}
+	table := bookChaptersKey("斗破苍穹", "天蚕土豆")
+	if !strings.Contains(inserts[0].query, "`"+table+"`") || "1" != inserts[0].args[0] {
+		t.Errorf("MigrateChapters: got %+v", inserts[0])
+	}
+
+	for _, stmt := range d.recorded() {
+		if strings.Contains(stmt.query, "`chapter_contents`") {
+			t.Errorf("MigrateChapters: chapter contents already keyed by book id, got %s", stmt.query)
+		}
+	}
+
+	d.stmts = nil
+	d.setResult("select count(*) from information_schema.columns where table_schema=database()"+
+		" and table_name=? and column_name=?", []driver.Value{int64(1)})
+	err = RunMigration(store, "chapters")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var rekeys []recordedStmt
+	for _, stmt := range d.recorded() {
+		if strings.HasPrefix(stmt.query, "update `chapter_contents`") || strings.HasPrefix(stmt.query, "alter") {
+			rekeys = append(rekeys, stmt)
+		}
+	}
+	if 3 != len(rekeys) || "1" != rekeys[0].args[0] || table != rekeys[0].args[1] ||
+		!strings.Contains(rekeys[2].query, "change column `book_key` `book_id`") {
+		t.Errorf("MigrateChapters: chapter contents not keyed by book id, got %+v", rekeys)
+	}
+
+	if err := RunMigration(store, "unknown"); nil == err {
+		t.Error("RunMigration(unknown): expected error")
+	}
+}
+
+func TestIncBookCountersAtomic(t *testing.T) {
+	store, d := newRecordBookStore(t)
+	err := store.IncBookCounters(map[string]BookCounters{"1": {Reads: 2, Votes: 1}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	stmts := d.recorded()
+	if 1 != len(stmts) || !strings.Contains(stmts[0].query, "total_reads=total_reads+?") ||
+		int64(2) != stmts[0].args[0] || "1" != stmts[0].args[3] {
+		t.Errorf("IncBookCounters: got %+v", stmts)
+	}
+}
+
+func TestSetRecommendBooksDiff(t *testing.T) {
+	store, d := newRecordBookStore(t)
+	d.setResult("select book_id, rwords, ruser, position from `director_recommend_books` for update",
+		[]driver.Value{"1", "旧", "编辑", int64(1)}, []driver.Value{"2", "好看", "编辑", int64(0)})
+	d.setResult("select coalesce(max(version), 0) from `recommend_versions` where clazz=? for update",
+		[]driver.Value{int64(4)})
+
+	version := RecommendVersion{Clazz: "directorrecommend", Author: "root"}
+	books := []recommendBook{{Id: "2", RWords: "好看", RUser: "编辑"}, {Id: "1", RWords: "新", RUser: "编辑"}, {Id: "3"}}
+	err := store.SetRecommendBooks("director_recommend_books", true, books, &version)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 5 != version.Version {
+		t.Errorf("SetRecommendBooks: expected version 5, got %d", version.Version)
+	}
+
+	var writes []string
+	for _, stmt := range d.recorded() {
+		if strings.Contains(stmt.query, "truncate") {
+			t.Errorf("SetRecommendBooks: unexpected %s", stmt.query)
+		}
+		if !strings.HasPrefix(stmt.query, "select") {
+			writes = append(writes, stmt.query)
+		}
+	}
+	if 3 != len(writes) || !strings.HasPrefix(writes[0], "update `director_recommend_books`") ||
+		!strings.HasPrefix(writes[1], "insert into `director_recommend_books`") ||
+		!strings.HasPrefix(writes[2], "insert into `recommend_versions`") {
+		t.Errorf("SetRecommendBooks: got %q", writes)
+	}
+}
+
+func TestSetRecommendBooksReorder(t *testing.T) {
+	store, d := newRecordBookStore(t)
+	d.setResult("select book_id, '', '', position from `main_recommend_books` for update",
+		[]driver.Value{"1", "", "", int64(0)}, []driver.Value{"2", "", "", int64(1)},
+		[]driver.Value{"3", "", "", int64(2)})
+
+	books := []recommendBook{{Id: "1"}, {Id: "3"}, {Id: "2"}}
+	err := store.SetRecommendBooks("main_recommend_books", false, books, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var writes []recordedStmt
+	for _, stmt := range d.recorded() {
+		if !strings.HasPrefix(stmt.query, "select") {
+			writes = append(writes, stmt)
+		}
+	}
+	if 2 != len(writes) ||
+		"update `main_recommend_books` set position=? where book_id=?" != writes[0].query ||
+		int64(1) != writes[0].args[0] || "3" != writes[0].args[1] ||
+		int64(2) != writes[1].args[0] || "2" != writes[1].args[1] {
+		t.Errorf("SetRecommendBooks reorder: got %+v", writes)
+	}
+
+	_, err = store.QueryRecommendBooks("main_recommend_books", false, BookFilter{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	stmts := d.recorded()
+	if query := stmts[len(stmts)-1].query; !strings.HasSuffix(query, " order by b.`position`") {
+		t.Errorf("QueryRecommendBooks: expected list order, got %s", query)
+	}
+}
+
+func TestMigrateRecommendPositions(t *testing.T) {
+	store, d := newRecordBookStore(t)
+	lists := []RecommendListCfg{{Name: "fprecommend", Table: "main_recommend_books"}, {Name: "bad", Table: "a;b"}}
+
+	err := store.MigrateRecommendPositions(lists)
+	if nil != err {
+		t.Fatal(err)
+	}
+	stmts := d.recorded()
+	if 2 != len(stmts) ||
+		"alter table `main_recommend_books` add column `position` int not null default 0" != stmts[1].query {
+		t.Errorf("MigrateRecommendPositions: got %+v", stmts)
+	}
+}
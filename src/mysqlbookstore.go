@@ -0,0 +1,817 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func scanBook(rows *sql.Rows, extra ...interface{}) (*Book, error) {
+	var book Book
+	dest := []interface{}{&book.Id, &book.Name, &book.Abbreviation, &book.Author,
+		&book.Cover, &book.AuthorAvatar, &book.Finished, &book.TotalReads,
+		&book.TotalChars, &book.LastUpdateTime, &book.Class, &book.TotalSearches,
+		&book.TotalVotes, &book.LastChapterTitle, &book.LastChapterUrl,
+		&book.WithVIPChapter, &book.Gender, &book.Score}
+	err := rows.Scan(append(dest, extra...)...)
+	return &book, err
+}
+
+func (s *MysqlBookStore) queryBooks(sqlExec string, args ...interface{}) ([]*Book, error) {
+	var books = make([]*Book, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		book, err := scanBook(rows)
+		books = append(books, book)
+		return err
+	}, args...)
+	return books, err
+}
+
+var mysqlOrderColumns = map[string]bool{
+	orderByVotes:    true,
+	orderByReads:    true,
+	orderBySearches: true,
+	orderByChars:    true,
+	orderByScore:    true,
+	orderById:       true,
+}
+
+func sqlOrderString(order string) string {
+	if !mysqlOrderColumns[order] {
+		order = orderByScore
+	}
+	return "order by " + order + " desc"
+}
+
+func sqlWhereString(conds []string) string {
+	if 0 == len(conds) {
+		return ""
+	}
+	return " where " + strings.Join(conds, " and ")
+}
+
+func extraSqlConds(gender string, finished bool) []string {
+	conds := make([]string, 0)
+	if gender == "girl" {
+		conds = append(conds, "gender='girl'")
+	}
+	if finished {
+		conds = append(conds, "finished=1")
+	}
+	return conds
+}
+
+func extraSqlWhereString(gender string, finished bool) string {
+	return sqlWhereString(extraSqlConds(gender, finished))
+}
+
+func (s *MysqlBookStore) QueryBooks(filter BookFilter, order string, offset int, limit int) ([]*Book, error) {
+	conds := extraSqlConds(filter.Gender, filter.Finished)
+	args := make([]interface{}, 0)
+	if "" != filter.Clazz {
+		conds = append(conds, "class=?")
+		args = append(args, filter.Clazz)
+	}
+	args = append(args, limit, offset)
+	sqlExec := fmt.Sprintf("select * from `books_table`%s %s limit ? offset ?",
+		sqlWhereString(conds), sqlOrderString(order))
+	return s.queryBooks(sqlExec, args...)
+}
+
+func (s *MysqlBookStore) CountBooks(filter BookFilter) (int, error) {
+	sqlExec := "select count(*) from `books_table`" + extraSqlWhereString(filter.Gender, filter.Finished)
+	count := 0
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	})
+	return count, err
+}
+
+func (s *MysqlBookStore) QueryClazzs(filter BookFilter) ([]string, error) {
+	sqlExec := "select distinct class from `books_table`" + extraSqlWhereString(filter.Gender, filter.Finished)
+	clazzs := make([]string, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		bytes := make([]byte, 128)
+		err := rows.Scan(&bytes)
+		if nil == err && 0 != len(bytes) {
+			clazzs = append(clazzs, string(bytes))
+		}
+		return err
+	})
+	return clazzs, err
+}
+
+func (s *MysqlBookStore) GetBook(id string) (*Book, error) {
+	books, err := s.queryBooks("select * from `books_table` where id=?", id)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(books) {
+		return nil, nil
+	}
+	return books[0], nil
+}
+
+func (s *MysqlBookStore) QueryRecommendBooks(table string, notes bool, filter BookFilter) ([]*Book, error) {
+	columns := "a.*"
+	if notes {
+		columns = "a.*, b.rwords, b.ruser"
+	}
+	sqlWhere := extraSqlWhereString(filter.Gender, filter.Finished)
+	sqlExec := fmt.Sprintf("select %s from `books_table` a join `%s` b on a.`id`=b.`book_id`%s order by b.`position`",
+		columns, table, sqlWhere)
+
+	var books = make([]*Book, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var book *Book
+		var err error
+		if notes {
+			var rwords, ruser string
+			book, err = scanBook(rows, &rwords, &ruser)
+			book.RWords = rwords
+			book.RUser = ruser
+		} else {
+			book, err = scanBook(rows)
+		}
+		books = append(books, book)
+		return err
+	})
+	return books, err
+}
+
+type recommendRow struct {
+	recommendBook
+	position int
+}
+
+func queryRecommendRows(tx *sql.Tx, table string, notes bool) (map[string]recommendRow, error) {
+	columns := "book_id, '', '', position"
+	if notes {
+		columns = "book_id, rwords, ruser, position"
+	}
+	rows, err := tx.Query(fmt.Sprintf("select %s from `%s` for update", columns, table))
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	current := make(map[string]recommendRow)
+	for rows.Next() {
+		var row recommendRow
+		err = rows.Scan(&row.Id, &row.RWords, &row.RUser, &row.position)
+		if nil != err {
+			return nil, err
+		}
+		current[row.Id] = row
+	}
+	return current, rows.Err()
+}
+
+// SetRecommendBooks replaces a list in one transaction, only touching the
+// rows that changed, so readers never see it empty. A non nil version is
+// stored in the same transaction and gets its Id and Version assigned.
+func (s *MysqlBookStore) SetRecommendBooks(table string, notes bool, books []recommendBook, version *RecommendVersion) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		current, err := queryRecommendRows(tx, table, notes)
+		if nil != err {
+			return err
+		}
+
+		wanted := make(map[string]bool, len(books))
+		for _, book := range books {
+			if wanted[book.Id] {
+				continue
+			}
+			position := len(wanted)
+			wanted[book.Id] = true
+			old, ok := current[book.Id]
+			switch {
+			case !ok && notes:
+				_, err = tx.Exec(fmt.Sprintf("insert into `%s` (book_id, rwords, ruser, position) values (?, ?, ?, ?)",
+					table), book.Id, book.RWords, book.RUser, position)
+			case !ok:
+				_, err = tx.Exec(fmt.Sprintf("insert into `%s` (book_id, position) values (?, ?)", table),
+					book.Id, position)
+			case notes && (old.RWords != book.RWords || old.RUser != book.RUser):
+				_, err = tx.Exec(fmt.Sprintf("update `%s` set rwords=?, ruser=?, position=? where book_id=?", table),
+					book.RWords, book.RUser, position, book.Id)
+			case old.position != position:
+				_, err = tx.Exec(fmt.Sprintf("update `%s` set position=? where book_id=?", table),
+					position, book.Id)
+			}
+			if nil != err {
+				return err
+			}
+		}
+		for bookId := range current {
+			if wanted[bookId] {
+				continue
+			}
+			_, err = tx.Exec(fmt.Sprintf("delete from `%s` where book_id=?", table), bookId)
+			if nil != err {
+				return err
+			}
+		}
+
+		if nil == version {
+			return nil
+		}
+		return insertRecommendVersion(tx, version)
+	})
+}
+
+func insertRecommendVersion(tx *sql.Tx, version *RecommendVersion) error {
+	booksJSON, err := json.Marshal(version.Books)
+	if nil != err {
+		return err
+	}
+	latest := 0
+	err = tx.QueryRow("select coalesce(max(version), 0) from `recommend_versions` where clazz=? for update",
+		version.Clazz).Scan(&latest)
+	if nil != err {
+		return err
+	}
+	version.Version = latest + 1
+
+	result, err := tx.Exec("insert into `recommend_versions` (clazz, version, author, created_at, books, rollback_of)"+
+		" values (?, ?, ?, ?, ?, ?)", version.Clazz, version.Version, version.Author, version.CreatedAt,
+		string(booksJSON), version.RollbackOf)
+	if nil != err {
+		return err
+	}
+	version.Id, err = result.LastInsertId()
+	return err
+}
+
+func (s *MysqlBookStore) queryRecommendVersions(sqlExec string, args ...interface{}) ([]*RecommendVersion, error) {
+	versions := make([]*RecommendVersion, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var v RecommendVersion
+		var booksJSON string
+		err := rows.Scan(&v.Id, &v.Clazz, &v.Version, &v.Author, &v.CreatedAt, &booksJSON, &v.RollbackOf)
+		if nil != err {
+			return err
+		}
+		err = json.Unmarshal([]byte(booksJSON), &v.Books)
+		if nil == err {
+			versions = append(versions, &v)
+		}
+		return err
+	}, args...)
+	return versions, err
+}
+
+func (s *MysqlBookStore) QueryRecommendVersions(clazz string, offset int, limit int) ([]*RecommendVersion, error) {
+	return s.queryRecommendVersions("select id, clazz, version, author, created_at, books, rollback_of"+
+		" from `recommend_versions` where clazz=? order by version desc limit ? offset ?", clazz, limit, offset)
+}
+
+func (s *MysqlBookStore) GetRecommendVersion(clazz string, version int) (*RecommendVersion, error) {
+	versions, err := s.queryRecommendVersions("select id, clazz, version, author, created_at, books, rollback_of"+
+		" from `recommend_versions` where clazz=? and version=?", clazz, version)
+	if nil != err || 0 == len(versions) {
+		return nil, err
+	}
+	return versions[0], nil
+}
+
+func (s *MysqlBookStore) IsRecommendBook(table string, bookId string) (bool, error) {
+	count := 0
+	sqlExec := fmt.Sprintf("select count(*) from `%s` where book_id=?", table)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	}, bookId)
+	return 0 < count, err
+}
+
+func (s *MysqlBookStore) AddRecommendSchedule(schedule *RecommendSchedule) error {
+	booksJSON, err := json.Marshal(schedule.Books)
+	if nil != err {
+		return err
+	}
+	result, err := s.db.Exec("insert into `recommend_schedules`"+
+		" (clazz, author, publish_at, expire_at, state, version, created_at, books)"+
+		" values (?, ?, ?, ?, ?, ?, ?, ?)", schedule.Clazz, schedule.Author, schedule.PublishAt,
+		schedule.ExpireAt, schedule.State, schedule.Version, schedule.CreatedAt, string(booksJSON))
+	if nil != err {
+		return err
+	}
+	schedule.Id, err = result.LastInsertId()
+	return err
+}
+
+const sqlRecommendScheduleColumns = "id, clazz, author, publish_at, expire_at, state, version," +
+	" created_at, books"
+
+func (s *MysqlBookStore) queryRecommendSchedules(sqlExec string, args ...interface{}) ([]*RecommendSchedule, error) {
+	schedules := make([]*RecommendSchedule, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var v RecommendSchedule
+		var booksJSON string
+		err := rows.Scan(&v.Id, &v.Clazz, &v.Author, &v.PublishAt, &v.ExpireAt, &v.State, &v.Version,
+			&v.CreatedAt, &booksJSON)
+		if nil != err {
+			return err
+		}
+		err = json.Unmarshal([]byte(booksJSON), &v.Books)
+		if nil == err {
+			schedules = append(schedules, &v)
+		}
+		return err
+	}, args...)
+	return schedules, err
+}
+
+func (s *MysqlBookStore) GetRecommendSchedule(id int64) (*RecommendSchedule, error) {
+	schedules, err := s.queryRecommendSchedules("select "+sqlRecommendScheduleColumns+
+		" from `recommend_schedules` where id=?", id)
+	if nil != err || 0 == len(schedules) {
+		return nil, err
+	}
+	return schedules[0], nil
+}
+
+// UpdateRecommendSchedule only applies when the schedule is still in
+// fromState, so concurrent schedulers can't both act on it.
+func (s *MysqlBookStore) UpdateRecommendSchedule(schedule *RecommendSchedule, fromState string) (bool, error) {
+	result, err := s.db.Exec("update `recommend_schedules` set state=?, version=? where id=? and state=?",
+		schedule.State, schedule.Version, schedule.Id, fromState)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) QueryDueRecommendSchedules(now int64) ([]*RecommendSchedule, error) {
+	return s.queryRecommendSchedules("select "+sqlRecommendScheduleColumns+" from `recommend_schedules`"+
+		" where (state=? and publish_at<=?) or (state=? and expire_at>0 and expire_at<=?)"+
+		" order by if(state=?, publish_at, expire_at), id",
+		schedulePending, now, schedulePublished, now, schedulePending)
+}
+
+func (s *MysqlBookStore) QueryRecommendSchedules(clazz string, offset int, limit int) ([]*RecommendSchedule, error) {
+	return s.queryRecommendSchedules("select "+sqlRecommendScheduleColumns+" from `recommend_schedules`"+
+		" where clazz=? order by id desc limit ? offset ?", clazz, limit, offset)
+}
+
+var sqlLikeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+func sqlSearchWhere(key string) (string, []interface{}) {
+	if "" == strings.TrimSpace(key) {
+		return "", nil
+	}
+	like := ""
+	for _, c := range strings.Split(key, "") {
+		like += "%" + sqlLikeEscaper.Replace(c)
+	}
+	like += "%"
+	return " where author like ? or name like ? or class like ?", []interface{}{like, like, like}
+}
+
+func (s *MysqlBookStore) SearchBooks(key string, offset int, limit int) ([]*Book, error) {
+	sqlWhere, args := sqlSearchWhere(key)
+	args = append(args, limit, offset)
+	sqlExec := fmt.Sprintf("select * from `books_table`%s order by score desc limit ? offset ?", sqlWhere)
+	return s.queryBooks(sqlExec, args...)
+}
+
+func (s *MysqlBookStore) CountSearchBooks(key string) (int, error) {
+	sqlWhere, args := sqlSearchWhere(key)
+	sqlExec := fmt.Sprintf("select count(*) from `books_table`%s", sqlWhere)
+	count := -1
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	}, args...)
+	return count, err
+}
+
+func (s *MysqlBookStore) queryChapters(sqlExec string, args ...interface{}) ([]*Chapter, error) {
+	var chapters = make([]*Chapter, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var chapter Chapter
+		err := rows.Scan(&chapter.NativeId, &chapter.Id, &chapter.Title, &chapter.Url, &chapter.Vip)
+		chapters = append(chapters, &chapter)
+		return err
+	}, args...)
+	return chapters, err
+}
+
+func (s *MysqlBookStore) GetBookChapters(bookId string) ([]*Chapter, error) {
+	return s.queryChapters("select native_id, id, title, url, vip from `chapters`"+
+		" where book_id=? order by native_id", bookId)
+}
+
+func (s *MysqlBookStore) QueryBookChapters(bookId string, afterNativeId int, offset int, limit int) ([]*Chapter, error) {
+	sqlExec := "select native_id, id, title, url, vip from `chapters`" +
+		" where book_id=? and native_id>? order by native_id"
+	args := []interface{}{bookId, afterNativeId}
+	if 0 < limit {
+		sqlExec += " limit ? offset ?"
+		args = append(args, limit, offset)
+	} else if 0 < offset {
+		sqlExec += " limit 18446744073709551615 offset ?"
+		args = append(args, offset)
+	}
+	return s.queryChapters(sqlExec, args...)
+}
+
+func (s *MysqlBookStore) CountBookChapters(bookId string, afterNativeId int) (int, error) {
+	count := 0
+	err := s.query("select count(*) from `chapters` where book_id=? and native_id>?", func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	}, bookId, afterNativeId)
+	return count, err
+}
+
+func (s *MysqlBookStore) GetLatestBookChapter(bookId string) (*Chapter, error) {
+	chapters, err := s.queryChapters("select native_id, id, title, url, vip from `chapters`"+
+		" where book_id=? order by native_id desc limit 1", bookId)
+	if nil != err || 0 == len(chapters) {
+		return nil, err
+	}
+	return chapters[0], nil
+}
+
+func (s *MysqlBookStore) GetChapterContent(bookId string, chapterId string) (*StoredChapterContent, error) {
+	var content *StoredChapterContent
+	err := s.query("select host, checksum, fetched_at, content from `chapter_contents`"+
+		" where book_id=? and chapter_id=?", func(rows *sql.Rows) error {
+		var text string
+		var fetchedAt int64
+		c := StoredChapterContent{BookId: bookId, ChapterId: chapterId}
+		err := rows.Scan(&c.Host, &c.Checksum, &fetchedAt, &text)
+		if nil != err {
+			return err
+		}
+		c.FetchedAt = time.Unix(fetchedAt, 0)
+		c.Paragraphs = strings.Split(text, "\n")
+		content = &c
+		return nil
+	}, bookId, chapterId)
+	return content, err
+}
+
+func (s *MysqlBookStore) SaveChapterContent(content *StoredChapterContent) error {
+	return s.exec("insert into `chapter_contents` (book_id, chapter_id, host, checksum, fetched_at, content)"+
+		" values (?, ?, ?, ?, ?, ?) on duplicate key update"+
+		" host=values(host), checksum=values(checksum), fetched_at=values(fetched_at), content=values(content)",
+		content.BookId, content.ChapterId, content.Host, content.Checksum,
+		content.FetchedAt.Unix(), strings.Join(content.Paragraphs, "\n"))
+}
+
+func (s *MysqlBookStore) IncBookCounters(deltas map[string]BookCounters) error {
+	if 0 == len(deltas) {
+		return nil
+	}
+	return s.transaction(func(tx *sql.Tx) error {
+		for id, delta := range deltas {
+			_, err := tx.Exec("update `books_table` set total_reads=total_reads+?,"+
+				" total_searches=total_searches+?, total_votes=total_votes+? where id=?",
+				delta.Reads, delta.Searches, delta.Votes, id)
+			if nil != err {
+				return err
+			}
+			if 0 == delta.Opens {
+				continue
+			}
+			_, err = tx.Exec("insert into `book_opens` (book_id, total_opens) values (?, ?)"+
+				" on duplicate key update total_opens=total_opens+?", id, delta.Opens, delta.Opens)
+			if nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MysqlBookStore) DeleteBookReaders(beforeDay string) error {
+	return s.exec("delete from `book_readers` where day<?", beforeDay)
+}
+
+func (s *MysqlBookStore) AddBookReader(bookId string, clientId string, day string) (bool, error) {
+	result, err := s.db.Exec("insert ignore into `book_readers` (book_id, client_id, day) values (?, ?, ?)",
+		bookId, clientId, day)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) GetBookOpens(bookId string) (int, error) {
+	opens := 0
+	err := s.query("select total_opens from `book_opens` where book_id=?", func(rows *sql.Rows) error {
+		return rows.Scan(&opens)
+	}, bookId)
+	return opens, err
+}
+
+func (s *MysqlBookStore) AddShelfBook(entry *ShelfEntry) (bool, error) {
+	result, err := s.db.Exec("insert ignore into `shelf_books`"+
+		" (client_id, book_id, position, added_at, opened_at, seen_native_id) values (?, ?, ?, ?, ?, ?)",
+		entry.ClientId, entry.BookId, entry.Position, entry.AddedAt, entry.OpenedAt, entry.SeenNativeId)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) RemoveShelfBook(clientId string, bookId string) (bool, error) {
+	result, err := s.db.Exec("delete from `shelf_books` where client_id=? and book_id=?", clientId, bookId)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) QueryShelfBooks(clientId string) ([]*ShelfEntry, error) {
+	entries := make([]*ShelfEntry, 0)
+	err := s.query("select client_id, book_id, position, added_at, opened_at, seen_native_id"+
+		" from `shelf_books` where client_id=? order by position, added_at", func(rows *sql.Rows) error {
+		var entry ShelfEntry
+		err := rows.Scan(&entry.ClientId, &entry.BookId, &entry.Position,
+			&entry.AddedAt, &entry.OpenedAt, &entry.SeenNativeId)
+		if nil == err {
+			entries = append(entries, &entry)
+		}
+		return err
+	}, clientId)
+	return entries, err
+}
+
+func (s *MysqlBookStore) SetShelfPositions(clientId string, bookIds []string) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		for position, bookId := range bookIds {
+			_, err := tx.Exec("update `shelf_books` set position=? where client_id=? and book_id=?",
+				position, clientId, bookId)
+			if nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MysqlBookStore) MarkShelfBookOpened(clientId string, bookId string, seenNativeId int, openedAt int64) error {
+	return s.exec("update `shelf_books` set seen_native_id=?, opened_at=? where client_id=? and book_id=?",
+		seenNativeId, openedAt, clientId, bookId)
+}
+
+// SaveReadingProgress only replaces a stored position with a newer one.
+// updated_at is assigned last because MySQL evaluates the assignments in order.
+func (s *MysqlBookStore) SaveReadingProgress(progress *ReadingProgress) (bool, error) {
+	result, err := s.db.Exec("insert into `reading_progress` (client_id, book_id, native_id, read_offset, updated_at)"+
+		" values (?, ?, ?, ?, ?) on duplicate key update"+
+		" native_id=if(values(updated_at)>=updated_at, values(native_id), native_id),"+
+		" read_offset=if(values(updated_at)>=updated_at, values(read_offset), read_offset),"+
+		" updated_at=greatest(updated_at, values(updated_at))",
+		progress.ClientId, progress.BookId, progress.NativeId, progress.Offset, progress.UpdatedAt)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) queryReadingProgress(sqlExec string, args ...interface{}) ([]*ReadingProgress, error) {
+	progresses := make([]*ReadingProgress, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var p ReadingProgress
+		err := rows.Scan(&p.ClientId, &p.BookId, &p.NativeId, &p.Offset, &p.UpdatedAt)
+		if nil == err {
+			progresses = append(progresses, &p)
+		}
+		return err
+	}, args...)
+	return progresses, err
+}
+
+func (s *MysqlBookStore) GetReadingProgress(clientId string, bookId string) (*ReadingProgress, error) {
+	progresses, err := s.queryReadingProgress("select client_id, book_id, native_id, read_offset, updated_at"+
+		" from `reading_progress` where client_id=? and book_id=?", clientId, bookId)
+	if nil != err || 0 == len(progresses) {
+		return nil, err
+	}
+	return progresses[0], nil
+}
+
+func (s *MysqlBookStore) QueryReadingProgress(clientId string, offset int, limit int) ([]*ReadingProgress, error) {
+	return s.queryReadingProgress("select client_id, book_id, native_id, read_offset, updated_at"+
+		" from `reading_progress` where client_id=? order by updated_at desc, book_id limit ? offset ?",
+		clientId, limit, offset)
+}
+
+func (s *MysqlBookStore) AddAccount(account *Account) error {
+	result, err := s.db.Exec("insert into `accounts` (name, password_hash, created_at) values (?, ?, ?)",
+		account.Name, account.PasswordHash, account.CreatedAt)
+	if nil != err {
+		return err
+	}
+	account.Id, err = result.LastInsertId()
+	return err
+}
+
+func (s *MysqlBookStore) queryAccount(sqlExec string, args ...interface{}) (*Account, error) {
+	var account *Account
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var a Account
+		err := rows.Scan(&a.Id, &a.Name, &a.PasswordHash, &a.CreatedAt)
+		if nil == err {
+			account = &a
+		}
+		return err
+	}, args...)
+	return account, err
+}
+
+func (s *MysqlBookStore) GetAccount(id int64) (*Account, error) {
+	return s.queryAccount("select id, name, password_hash, created_at from `accounts` where id=?", id)
+}
+
+func (s *MysqlBookStore) GetAccountByName(name string) (*Account, error) {
+	return s.queryAccount("select id, name, password_hash, created_at from `accounts` where name=?", name)
+}
+
+func (s *MysqlBookStore) LinkClient(clientId string, accountId int64) error {
+	return s.exec("insert into `account_clients` (client_id, account_id) values (?, ?)"+
+		" on duplicate key update account_id=?", clientId, accountId, accountId)
+}
+
+func (s *MysqlBookStore) SetClientSecret(clientId string, secretHash string) (bool, error) {
+	result, err := s.db.Exec("insert ignore into `client_secrets` (client_id, secret_hash) values (?, ?)",
+		clientId, secretHash)
+	if nil != err {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return 0 < n, err
+}
+
+func (s *MysqlBookStore) GetClientSecret(clientId string) (string, error) {
+	secretHash := ""
+	err := s.query("select secret_hash from `client_secrets` where client_id=?", func(rows *sql.Rows) error {
+		return rows.Scan(&secretHash)
+	}, clientId)
+	return secretHash, err
+}
+
+func (s *MysqlBookStore) GetClientAccount(clientId string) (int64, error) {
+	var accountId int64
+	err := s.query("select account_id from `account_clients` where client_id=?", func(rows *sql.Rows) error {
+		return rows.Scan(&accountId)
+	}, clientId)
+	return accountId, err
+}
+
+func (s *MysqlBookStore) QueryAccountClients(accountId int64) ([]string, error) {
+	clientIds := make([]string, 0)
+	err := s.query("select client_id from `account_clients` where account_id=? order by client_id",
+		func(rows *sql.Rows) error {
+			clientId := ""
+			err := rows.Scan(&clientId)
+			if nil == err {
+				clientIds = append(clientIds, clientId)
+			}
+			return err
+		}, accountId)
+	return clientIds, err
+}
+
+func (s *MysqlBookStore) MoveOwnerData(from string, to string) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		stmts := []string{
+			"insert ignore into `shelf_books` (client_id, book_id, position, added_at, opened_at, seen_native_id)" +
+				" select ?, book_id, position, added_at, opened_at, seen_native_id from `shelf_books` where client_id=?",
+			"insert into `reading_progress` (client_id, book_id, native_id, read_offset, updated_at)" +
+				" select ?, p.book_id, p.native_id, p.read_offset, p.updated_at from `reading_progress` p" +
+				" where p.client_id=? on duplicate key update" +
+				" native_id=if(values(updated_at)>=`reading_progress`.updated_at, values(native_id), `reading_progress`.native_id)," +
+				" read_offset=if(values(updated_at)>=`reading_progress`.updated_at, values(read_offset), `reading_progress`.read_offset)," +
+				" updated_at=greatest(`reading_progress`.updated_at, values(updated_at))",
+			"insert ignore into `book_readers` (book_id, client_id, day)" +
+				" select book_id, ?, day from `book_readers` where client_id=?",
+		}
+		for _, stmt := range stmts {
+			_, err := tx.Exec(stmt, to, from)
+			if nil != err {
+				return err
+			}
+		}
+		for _, table := range []string{"shelf_books", "reading_progress", "book_readers"} {
+			_, err := tx.Exec("delete from `"+table+"` where client_id=?", from)
+			if nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MysqlBookStore) AddVote(vote *Vote) error {
+	result, err := s.db.Exec("insert into `votes_table` (book_id, client_id, day, created_at, revoked)"+
+		" values (?, ?, ?, ?, 0)", vote.BookId, vote.ClientId, vote.Day, vote.CreatedAt)
+	if nil != err {
+		return err
+	}
+	vote.Id, err = result.LastInsertId()
+	return err
+}
+
+func (s *MysqlBookStore) queryVotes(sqlExec string, args ...interface{}) ([]*Vote, error) {
+	votes := make([]*Vote, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		var vote Vote
+		err := rows.Scan(&vote.Id, &vote.BookId, &vote.ClientId, &vote.Day, &vote.CreatedAt, &vote.Revoked)
+		if nil == err {
+			votes = append(votes, &vote)
+		}
+		return err
+	}, args...)
+	return votes, err
+}
+
+func sqlClientVotesWhere(clientId string, bookId string, day string) (string, []interface{}) {
+	sqlWhere := " where client_id=? and day=? and revoked=0"
+	args := []interface{}{clientId, day}
+	if "" != bookId {
+		sqlWhere += " and book_id=?"
+		args = append(args, bookId)
+	}
+	return sqlWhere, args
+}
+
+func (s *MysqlBookStore) CountClientVotes(clientId string, bookId string, day string) (int, error) {
+	sqlWhere, args := sqlClientVotesWhere(clientId, bookId, day)
+	count := 0
+	err := s.query("select count(*) from `votes_table`"+sqlWhere, func(rows *sql.Rows) error {
+		return rows.Scan(&count)
+	}, args...)
+	return count, err
+}
+
+func (s *MysqlBookStore) QueryClientVotes(clientId string, bookId string, day string) ([]*Vote, error) {
+	sqlWhere, args := sqlClientVotesWhere(clientId, bookId, day)
+	return s.queryVotes("select id, book_id, client_id, day, created_at, revoked from `votes_table`"+
+		sqlWhere+" order by id", args...)
+}
+
+func (s *MysqlBookStore) QueryBookVotes(bookId string, offset int, limit int) ([]*Vote, error) {
+	return s.queryVotes("select id, book_id, client_id, day, created_at, revoked from `votes_table`"+
+		" where book_id=? order by id desc limit ? offset ?", bookId, limit, offset)
+}
+
+func (s *MysqlBookStore) RevokeVote(id int64) (*Vote, error) {
+	result, err := s.db.Exec("update `votes_table` set revoked=1 where id=? and revoked=0", id)
+	if nil != err {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if nil != err || 0 == n {
+		return nil, err
+	}
+	votes, err := s.queryVotes("select id, book_id, client_id, day, created_at, revoked from `votes_table`"+
+		" where id=?", id)
+	if nil != err || 0 == len(votes) {
+		return nil, err
+	}
+	return votes[0], nil
+}
+
+func (s *MysqlBookStore) queryWords(sqlExec string, limit int) ([]string, error) {
+	words := make([]string, 0)
+	err := s.query(sqlExec, func(rows *sql.Rows) error {
+		word := ""
+		err := rows.Scan(&word)
+		if nil == err {
+			words = append(words, word)
+		}
+		return err
+	}, limit)
+	return words, err
+}
+
+func (s *MysqlBookStore) QueryHotWords(limit int) ([]string, error) {
+	return s.queryWords("select word from `search_words_table` order by count limit ?", limit)
+}
+
+func (s *MysqlBookStore) QueryTopSearchWords(limit int) ([]string, error) {
+	return s.queryWords("select word from `search_words_table` order by count desc limit ?", limit)
+}
+
+func (s *MysqlBookStore) GetSearchWordCount(word string) (int, error) {
+	count := 0
+	err := s.query("select * from `search_words_table` where word=?", func(rows *sql.Rows) error {
+		return rows.Scan(&word, &count)
+	}, word)
+	return count, err
+}
+
+func (s *MysqlBookStore) IncSearchWord(word string, delta int) error {
+	return s.exec("insert into `search_words_table` values (?, ?) on duplicate key update count=count+?",
+		word, delta, delta)
+}
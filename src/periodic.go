@@ -0,0 +1,47 @@
+package main
+
+import (
+	"kkt.com/glog"
+	"sync"
+	"time"
+)
+
+type PeriodicTask struct {
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewPeriodicTask(interval time.Duration, fn func() error) *PeriodicTask {
+	t := &PeriodicTask{
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	go t.run(interval, fn)
+	return t
+}
+
+func (t *PeriodicTask) run(interval time.Duration, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(t.doneCh)
+
+	for {
+		select {
+		case <-ticker.C:
+			err := fn()
+			if nil != err {
+				glog.Error(err)
+			}
+		case <-t.closeCh:
+			return
+		}
+	}
+}
+
+func (t *PeriodicTask) Close() {
+	t.closeOnce.Do(func() {
+		close(t.closeCh)
+	})
+	<-t.doneCh
+}
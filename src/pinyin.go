@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/mozillazg/go-pinyin"
+	"strings"
+	"unicode"
+)
+
+const (
+	pinyinNameWeight   = 4 * weightName
+	pinyinAuthorWeight = 4 * weightAuthor
+)
+
+var pinyinArgs = pinyin.Args{Style: pinyin.Normal, Heteronym: true}
+
+type pinyinUnit struct {
+	han       rune
+	syllables [][]rune
+}
+
+type pinyinText []pinyinUnit
+
+func newPinyinText(text string) pinyinText {
+	units := make(pinyinText, 0)
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isHan(r):
+			unit := pinyinUnit{han: r}
+			for _, syllable := range pinyin.SinglePinyin(r, pinyinArgs) {
+				unit.syllables = append(unit.syllables, []rune(syllable))
+			}
+			units = append(units, unit)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			units = append(units, pinyinUnit{syllables: [][]rune{{r}}})
+		}
+	}
+	return units
+}
+
+func pinyinKey(key string) []rune {
+	query := make([]rune, 0, len(key))
+	for _, r := range strings.ToLower(key) {
+		if isHan(r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			query = append(query, r)
+		}
+	}
+	return query
+}
+
+// Plain Chinese is left to the token index.
+func pinyinQuery(key string) []rune {
+	query := pinyinKey(key)
+	latin := false
+	for _, r := range query {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			latin = true
+		}
+	}
+	if !latin || len(query) < 2 {
+		return nil
+	}
+	return query
+}
+
+func hasRunePrefix(s []rune, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns whether query matches, whether at the start and whether it
+// spans the whole text.
+func (text pinyinText) match(query []rune) (bool, bool, bool) {
+	width := len(query) + 1
+	failed := make([]bool, (len(text)+1)*width)
+	for start := range text {
+		end, ok := text.matchFrom(query, start, 0, failed, width)
+		if ok {
+			return true, 0 == start, 0 == start && len(text) == end
+		}
+	}
+	return false, false, false
+}
+
+func (text pinyinText) matchPrefix(query []rune) (bool, bool) {
+	width := len(query) + 1
+	failed := make([]bool, (len(text)+1)*width)
+	end, ok := text.matchFrom(query, 0, 0, failed, width)
+	return ok, ok && len(text) == end
+}
+
+func (text pinyinText) matchFrom(query []rune, i int, j int, failed []bool, width int) (int, bool) {
+	if len(query) == j {
+		return i, true
+	}
+	if len(text) == i || failed[i*width+j] {
+		return 0, false
+	}
+
+	unit := text[i]
+	rest := query[j:]
+	if 0 != unit.han && unit.han == rest[0] {
+		if end, ok := text.matchFrom(query, i+1, j+1, failed, width); ok {
+			return end, true
+		}
+	}
+	for _, syllable := range unit.syllables {
+		for k := len(syllable); k > 0; k-- {
+			if !hasRunePrefix(rest, syllable[:k]) {
+				continue
+			}
+			if end, ok := text.matchFrom(query, i+1, j+k, failed, width); ok {
+				return end, true
+			}
+		}
+	}
+
+	failed[i*width+j] = true
+	return 0, false
+}
+
+func (doc *indexedBook) pinyinRelevance(query []rune) int {
+	relevance := 0
+	if ok, prefix, whole := doc.namePinyin.match(query); ok {
+		relevance += pinyinNameWeight
+		if whole {
+			relevance += bonusExactName
+		} else if prefix {
+			relevance += bonusNamePrefix
+		}
+	}
+	if ok, _, whole := doc.authorPinyin.match(query); ok {
+		relevance += pinyinAuthorWeight
+		if whole {
+			relevance += bonusExactAuthor
+		}
+	}
+	return relevance
+}
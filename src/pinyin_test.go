@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPinyinTextMatch(t *testing.T) {
+	text := newPinyinText("斗破苍穹")
+	cases := []struct {
+		query  string
+		ok     bool
+		prefix bool
+		whole  bool
+	}{
+		{"dpcq", true, true, true},
+		{"doupocangqiong", true, true, true},
+		{"斗po苍q", true, true, true},
+		{"doup", true, true, false},
+		{"pocang", true, false, false},
+		{"dpqc", false, false, false},
+	}
+	for _, c := range cases {
+		ok, prefix, whole := text.match([]rune(c.query))
+		if ok != c.ok || prefix != c.prefix || whole != c.whole {
+			t.Errorf("match(%s): got %t %t %t", c.query, ok, prefix, whole)
+		}
+	}
+}
+
+func TestPinyinQuery(t *testing.T) {
+	if nil != pinyinQuery("斗破") {
+		t.Error("pinyinQuery(斗破): expected plain Chinese to be left to the token index")
+	}
+	if nil != pinyinQuery("d") {
+		t.Error("pinyinQuery(d): expected a single letter to be ignored")
+	}
+	if query := pinyinQuery("Dou Po-苍"); "doupo苍" != string(query) {
+		t.Errorf("pinyinQuery(Dou Po-苍): got %s", string(query))
+	}
+}
+
+func TestSearchBooksPinyin(t *testing.T) {
+	setTestBookMgr(t)
+
+	cases := []struct {
+		key string
+		ids []string
+	}{
+		{"dpcq", []string{"1"}},
+		{"DouPoCangQiong", []string{"1"}},
+		{"斗po苍q", []string{"1"}},
+		{"wangyu", []string{"2"}},
+		{"frxx", []string{"2"}},
+		{"hqg", []string{"3"}},
+		{"qwerty", []string{}},
+	}
+	for _, c := range cases {
+		var result booksSearchResp
+		resp := doRequest(t, BookMgrsProc, "GET", "/books?a=s&c="+c.key, "", &result)
+		if 0 != resp.Code || len(c.ids) != result.TotalCount || !equalIds(result.Books, c.ids...) {
+			t.Errorf("search %s: got %d %d %v", c.key, resp.Code, result.TotalCount, bookIds(result.Books))
+		}
+	}
+}
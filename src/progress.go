@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const maxProgressSkew = 300
+
+type ReadingProgress struct {
+	ClientId  string `json:"client_id"`
+	BookId    string `json:"book_id"`
+	NativeId  int    `json:"native_id"`
+	Offset    int    `json:"offset"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type ContinueReading struct {
+	*Book
+	Progress *ReadingProgress `json:"progress"`
+	Chapter  *Chapter         `json:"chapter"`
+}
+
+type progressReqP struct {
+	ReadingProgress
+	Token string `json:"token"`
+}
+
+func (mgr *BookMgr) parseProgressReqBody(body interface{}) (*ReadingProgress, error) {
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return nil, err
+	}
+	var p progressReqP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return nil, err
+	}
+	if "" == p.BookId || 0 > p.Offset {
+		return nil, errors.New("Invalid parameter")
+	}
+	p.ClientId, err = mgr.ownerId(p.ClientId, p.Token)
+	if nil != err {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if 0 >= p.UpdatedAt {
+		p.UpdatedAt = now
+	} else if p.UpdatedAt > now+maxProgressSkew {
+		p.UpdatedAt = now + maxProgressSkew
+	}
+	return &p.ReadingProgress, nil
+}
+
+func (mgr *BookMgr) findChapter(bookId string, nativeId int) (*Chapter, error) {
+	chapters, err := mgr.store.QueryBookChapters(bookId, nativeId-1, 0, 1)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(chapters) || nativeId != chapters[0].NativeId {
+		return nil, nil
+	}
+	return chapters[0], nil
+}
+
+// SaveReadingProgress keeps the newest position reported by any device and
+// counts the report as a read, so clients don't need a separate read call.
+func (mgr *BookMgr) SaveReadingProgress(body interface{}) (*ReadingProgress, *Book, error) {
+	p, err := mgr.parseProgressReqBody(body)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	book, err := mgr.store.GetBook(p.BookId)
+	if nil != err {
+		return nil, nil, err
+	}
+	if nil == book {
+		return nil, nil, errors.New("Invalid parameter")
+	}
+	chapter, err := mgr.findChapter(p.BookId, p.NativeId)
+	if nil != err {
+		return nil, nil, err
+	}
+	if nil == chapter {
+		return nil, nil, errors.New("Invalid parameter")
+	}
+
+	_, err = mgr.store.SaveReadingProgress(p)
+	if nil != err {
+		return nil, nil, err
+	}
+	progress, err := mgr.store.GetReadingProgress(p.ClientId, p.BookId)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	book, err = mgr.recordBookRead(book, p.ClientId)
+	if nil != err {
+		return nil, nil, err
+	}
+	return progress, book, nil
+}
+
+func (mgr *BookMgr) GetReadingProgress(clientId string, token string, bookId string) (*ReadingProgress, error) {
+	if "" == bookId {
+		return nil, errors.New("Invalid parameter")
+	}
+	owner, err := mgr.ownerId(clientId, token)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.store.GetReadingProgress(owner, bookId)
+}
+
+func (mgr *BookMgr) QueryContinueReading(clientId string, token string, offset int, limit int) ([]*ContinueReading, error) {
+	owner, err := mgr.ownerId(clientId, token)
+	if nil != err {
+		return nil, err
+	}
+	if 0 > offset {
+		offset = 0
+	}
+	if 0 >= limit {
+		limit = mgr.PageCount
+	}
+
+	progresses, err := mgr.store.QueryReadingProgress(owner, offset, limit)
+	if nil != err {
+		return nil, err
+	}
+
+	books := make([]*ContinueReading, 0, len(progresses))
+	for _, progress := range progresses {
+		book, err := mgr.getBook(progress.BookId)
+		if nil != err {
+			return nil, err
+		}
+		if nil == book {
+			continue
+		}
+		chapter, err := mgr.findChapter(progress.BookId, progress.NativeId)
+		if nil != err {
+			return nil, err
+		}
+		books = append(books, &ContinueReading{Book: book, Progress: progress, Chapter: chapter})
+	}
+	return books, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressSync(t *testing.T) {
+	setTestBookMgr(t)
+	var p progressResp
+	body := `{"action":"set","body":{"client_id":"c","book_id":"1","native_id":2,"offset":120,"updated_at":200}}`
+	resp := doRequest(t, ProgressProc, "POST", "/progress", body, &p)
+	if 0 != resp.Code || 2 != p.Progress.NativeId || 11 != p.Book.TotalReads {
+		t.Fatalf("POST /progress: got %+v %+v %+v", resp, p.Progress, p.Book)
+	}
+
+	// An older report from another device must not win.
+	body = `{"action":"set","body":{"client_id":"c","book_id":"1","native_id":1,"offset":5,"updated_at":100}}`
+	resp = doRequest(t, ProgressProc, "POST", "/progress", body, &p)
+	if 0 != resp.Code || 2 != p.Progress.NativeId || 120 != p.Progress.Offset || 11 != p.Book.TotalReads {
+		t.Errorf("POST /progress stale: got %+v %+v %+v", resp, p.Progress, p.Book)
+	}
+
+	p = progressResp{}
+	resp = doRequest(t, ProgressProc, "GET", "/progress?client_id=c&id=1", "", &p)
+	if 0 != resp.Code || nil == p.Progress || 200 != p.Progress.UpdatedAt {
+		t.Errorf("GET /progress: got %+v %+v", resp, p.Progress)
+	}
+
+	invalid := []string{
+		`{"action":"set","body":{"client_id":"c","book_id":"1","native_id":9}}`,
+		`{"action":"set","body":{"client_id":"c","book_id":"404","native_id":1}}`,
+		`{"action":"set","body":{"client_id":"c","book_id":"1","native_id":1,"offset":-1}}`,
+		`{"action":"set","body":{"book_id":"1","native_id":1}}`,
+		`{"action":"x","body":{}}`,
+	}
+	for _, body := range invalid {
+		if resp = doRequest(t, ProgressProc, "POST", "/progress", body, nil); -3 != resp.Code {
+			t.Errorf("POST /progress %s: expected -3, got %+v", body, resp)
+		}
+	}
+}
+
+func TestProgressFutureUpdatedAt(t *testing.T) {
+	setTestBookMgr(t)
+	var p progressResp
+	body := `{"action":"set","body":{"client_id":"c","book_id":"1","native_id":2,"offset":120,"updated_at":9999999999}}`
+	resp := doRequest(t, ProgressProc, "POST", "/progress", body, &p)
+	if 0 != resp.Code || p.Progress.UpdatedAt > time.Now().Unix()+maxProgressSkew {
+		t.Errorf("POST /progress future: got %+v %+v", resp, p.Progress)
+	}
+}
+
+func TestContinueReading(t *testing.T) {
+	store := setTestBookMgr(t)
+	store.AddBookChapters("3", []*Chapter{{NativeId: 1, Id: "h1", Title: "第一章"}})
+	mgr.SaveReadingProgress(map[string]interface{}{"client_id": "c", "book_id": "1", "native_id": 2, "updated_at": 100})
+	mgr.SaveReadingProgress(map[string]interface{}{"client_id": "c", "book_id": "3", "native_id": 1, "updated_at": 300})
+	mgr.SaveReadingProgress(map[string]interface{}{"client_id": "d", "book_id": "1", "native_id": 1, "updated_at": 400})
+
+	var list continueReadingResp
+	resp := doRequest(t, ProgressProc, "GET", "/progress?client_id=c", "", &list)
+	if 0 != resp.Code || 2 != len(list.Books) || "3" != list.Books[0].Id || "1" != list.Books[1].Id {
+		t.Fatalf("GET /progress list: got %+v %+v", resp, list.Books)
+	}
+	if nil == list.Books[1].Chapter || "c2" != list.Books[1].Chapter.Id {
+		t.Errorf("GET /progress list: expected chapter c2, got %+v", list.Books[1].Chapter)
+	}
+
+	if resp = doRequest(t, ProgressProc, "GET", "/progress", "", nil); -2 != resp.Code {
+		t.Errorf("GET /progress without client: expected -2, got %+v", resp)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+type progressResp struct {
+	Progress *ReadingProgress `json:"progress"`
+	Book     *Book            `json:"book,omitempty"`
+}
+
+type continueReadingResp struct {
+	Books []*ContinueReading `json:"books"`
+}
+
+func progressGet(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	clientId := ""
+	if 0 < len(r.Form["client_id"]) {
+		clientId = r.Form["client_id"][0]
+	}
+	token := ""
+	if 0 < len(r.Form["token"]) {
+		token = r.Form["token"][0]
+	}
+	bookId := ""
+	if 0 < len(r.Form["id"]) {
+		bookId = r.Form["id"][0]
+	}
+	offset, err := formIntValue(r, "offset", 0)
+	if nil != err {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+	limit, err := formIntValue(r, "limit", 0)
+	if nil != err || ("" == clientId && "" == token) {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+
+	if "" != bookId {
+		progress, err := mgr.GetReadingProgress(clientId, token, bookId)
+		if nil != err {
+			Response(w, -3, err.Error(), nil)
+			return
+		}
+		Response(w, 0, "", progressResp{Progress: progress})
+		return
+	}
+
+	books, err := mgr.QueryContinueReading(clientId, token, offset, limit)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", continueReadingResp{Books: books})
+}
+
+func progressPost(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	var p apiPostP
+	err = json.Unmarshal(body, &p)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+
+	var resp progressResp
+	if "set" == p.Action {
+		resp.Progress, resp.Book, err = mgr.SaveReadingProgress(p.Body)
+	} else {
+		err = errors.New("Invalid action")
+	}
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", resp)
+}
+
+func ProgressProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		progressGet(w, r)
+	case "POST":
+		progressPost(w, r)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var defaultRecommendLists = []RecommendListCfg{
+	{Name: "fprecommend", Table: "main_recommend_books"},
+	{Name: "girlrecommend", Table: "girl_recommend_books"},
+	{Name: "shelfrecommend", Table: "shelf_recommend_books"},
+	{Name: "directorrecommend", Table: "director_recommend_books", Notes: true, Editor: true},
+	{Name: "finishedrecommend", Table: "finished_recommend_books"},
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// The stores can only narrow a list down to girl books.
+var recommendListGenders = map[string]bool{"": true, "girl": true}
+
+func validateRecommendLists(lists []RecommendListCfg) error {
+	for _, list := range lists {
+		if !recommendListGenders[list.Gender] {
+			return errors.New("Unsupported gender of recommend list " + list.Name + ": " + list.Gender)
+		}
+	}
+	return nil
+}
+
+func recommendLists() []RecommendListCfg {
+	if 0 == len(cfg.RecommendLists) {
+		return defaultRecommendLists
+	}
+	return cfg.RecommendLists
+}
+
+// findRecommendList returns the configured list named clazz. Lists whose
+// table is not a plain identifier are ignored, as the table name ends up in SQL.
+func findRecommendList(clazz string) *RecommendListCfg {
+	lists := recommendLists()
+	for i := range lists {
+		if clazz == lists[i].Name && sqlIdentifier.MatchString(lists[i].Table) {
+			return &lists[i]
+		}
+	}
+	return nil
+}
+
+type RecommendVersion struct {
+	Id         int64           `json:"id"`
+	Clazz      string          `json:"clazz"`
+	Version    int             `json:"version"`
+	Author     string          `json:"author"`
+	CreatedAt  int64           `json:"created_at"`
+	RollbackOf int             `json:"rollback_of,omitempty"`
+	Books      []recommendBook `json:"books"`
+}
+
+type recommendBookChange struct {
+	Id   string        `json:"id"`
+	From recommendBook `json:"from"`
+	To   recommendBook `json:"to"`
+}
+
+type RecommendDiff struct {
+	Clazz     string                `json:"clazz"`
+	From      int                   `json:"from"`
+	To        int                   `json:"to"`
+	Added     []recommendBook       `json:"added"`
+	Removed   []recommendBook       `json:"removed"`
+	Changed   []recommendBookChange `json:"changed"`
+	Reordered bool                  `json:"reordered"`
+}
+
+type recommendVersionP struct {
+	Clazz   string `json:"clazz"`
+	Offset  int    `json:"offset"`
+	Limit   int    `json:"limit"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Version int    `json:"version"`
+	Id      int64  `json:"id"`
+}
+
+func parseRecommendVersionBody(admin *AdminKeyCfg, body interface{}) (*recommendVersionP, error) {
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return nil, err
+	}
+	var p recommendVersionP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return nil, err
+	}
+	if nil == findRecommendList(p.Clazz) {
+		return nil, errors.New("Invalid parameter")
+	}
+	if !admin.canSetList(p.Clazz) {
+		return nil, errAdminForbidden
+	}
+	return &p, nil
+}
+
+func uniqueRecommendBooks(books []recommendBook) []recommendBook {
+	unique := make([]recommendBook, 0, len(books))
+	seen := make(map[string]bool, len(books))
+	for _, book := range books {
+		if !seen[book.Id] {
+			seen[book.Id] = true
+			unique = append(unique, book)
+		}
+	}
+	return unique
+}
+
+func (mgr *BookMgr) setRecommendList(admin *AdminKeyCfg, clazz string, books []recommendBook, rollbackOf int) (*RecommendVersion, error) {
+	list := findRecommendList(clazz)
+	if nil == list {
+		return nil, errors.New("Unknown recommend list " + clazz)
+	}
+	books = uniqueRecommendBooks(books)
+	if !list.Notes {
+		for i := range books {
+			books[i].RWords = ""
+			books[i].RUser = ""
+		}
+	}
+	version := RecommendVersion{
+		Clazz:      clazz,
+		Author:     admin.Name,
+		CreatedAt:  time.Now().Unix(),
+		RollbackOf: rollbackOf,
+		Books:      books,
+	}
+	err := mgr.store.SetRecommendBooks(list.Table, list.Notes, books, &version)
+	mgr.cache.DeletePrefix(listCachePrefix(clazz))
+	mgr.cache.DeletePrefix(homeCachePrefix)
+	if nil != err {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (mgr *BookMgr) QueryRecommendVersions(admin *AdminKeyCfg, body interface{}) ([]*RecommendVersion, error) {
+	p, err := parseRecommendVersionBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	if 0 > p.Offset {
+		p.Offset = 0
+	}
+	if 0 >= p.Limit {
+		p.Limit = mgr.PageCount
+	}
+	return mgr.store.QueryRecommendVersions(p.Clazz, p.Offset, p.Limit)
+}
+
+func (mgr *BookMgr) getRecommendVersion(clazz string, version int) (*RecommendVersion, error) {
+	v, err := mgr.store.GetRecommendVersion(clazz, version)
+	if nil != err {
+		return nil, err
+	}
+	if nil == v {
+		return nil, errors.New("Unknown version")
+	}
+	return v, nil
+}
+
+func diffRecommendBooks(from []recommendBook, to []recommendBook) *RecommendDiff {
+	diff := RecommendDiff{
+		Added:   make([]recommendBook, 0),
+		Removed: make([]recommendBook, 0),
+		Changed: make([]recommendBookChange, 0),
+	}
+	old := make(map[string]recommendBook, len(from))
+	for _, book := range from {
+		old[book.Id] = book
+	}
+	kept := make(map[string]bool, len(to))
+	for _, book := range to {
+		o, ok := old[book.Id]
+		if !ok {
+			diff.Added = append(diff.Added, book)
+			continue
+		}
+		kept[book.Id] = true
+		if o != book {
+			diff.Changed = append(diff.Changed, recommendBookChange{Id: book.Id, From: o, To: book})
+		}
+	}
+	for _, book := range from {
+		if !kept[book.Id] {
+			diff.Removed = append(diff.Removed, book)
+		}
+	}
+
+	// Compare the relative order of the books in both versions.
+	i := 0
+	for _, book := range to {
+		if !kept[book.Id] {
+			continue
+		}
+		for !kept[from[i].Id] {
+			i++
+		}
+		if from[i].Id != book.Id {
+			diff.Reordered = true
+			break
+		}
+		i++
+	}
+	return &diff
+}
+
+func (mgr *BookMgr) DiffRecommendVersions(admin *AdminKeyCfg, body interface{}) (*RecommendDiff, error) {
+	p, err := parseRecommendVersionBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	from, err := mgr.getRecommendVersion(p.Clazz, p.From)
+	if nil != err {
+		return nil, err
+	}
+	to, err := mgr.getRecommendVersion(p.Clazz, p.To)
+	if nil != err {
+		return nil, err
+	}
+
+	diff := diffRecommendBooks(from.Books, to.Books)
+	diff.Clazz = p.Clazz
+	diff.From = p.From
+	diff.To = p.To
+	return diff, nil
+}
+
+// RollbackBooks restores the books of an earlier version as a new version,
+// so the rollback itself shows up in the history.
+func (mgr *BookMgr) RollbackBooks(admin *AdminKeyCfg, body interface{}) (*RecommendVersion, error) {
+	p, err := parseRecommendVersionBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	v, err := mgr.getRecommendVersion(p.Clazz, p.Version)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.setRecommendList(admin, p.Clazz, v.Books, v.Version)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffRecommendBooks(t *testing.T) {
+	from := []recommendBook{{Id: "1"}, {Id: "2", RWords: "a"}, {Id: "3"}}
+	to := []recommendBook{{Id: "3"}, {Id: "2", RWords: "b"}, {Id: "4"}}
+	diff := diffRecommendBooks(from, to)
+	if 1 != len(diff.Added) || "4" != diff.Added[0].Id || 1 != len(diff.Removed) || "1" != diff.Removed[0].Id ||
+		1 != len(diff.Changed) || "b" != diff.Changed[0].To.RWords || !diff.Reordered {
+		t.Errorf("diffRecommendBooks: got %+v", diff)
+	}
+
+	diff = diffRecommendBooks(from, []recommendBook{{Id: "1"}, {Id: "3"}})
+	if diff.Reordered || 1 != len(diff.Removed) || 0 != len(diff.Added) {
+		t.Errorf("diffRecommendBooks without reorder: got %+v", diff)
+	}
+}
+
+func TestRecommendVersionsRollback(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	sets := []string{
+		`{"action":"set","body":{"clazz":"fprecommend","books":[{"id":"1"},{"id":"2"}]}}`,
+		`{"action":"set","body":{"clazz":"fprecommend","books":[{"id":"2"},{"id":"3"},{"id":"3"}]}}`,
+	}
+	for i, body := range sets {
+		resp := doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key")
+		var v recommendVersionResp
+		json.Unmarshal(resp.Body, &v)
+		if 0 != resp.Code || i+1 != v.Version.Version || "root" != v.Version.Author {
+			t.Fatalf("POST /books set %d: got %+v %+v", i, resp, v.Version)
+		}
+	}
+
+	resp := doAdminRequest(t, BookMgrsProc, "/books", `{"action":"versions","body":{"clazz":"fprecommend"}}`, "admin-key")
+	var versions recommendVersionsResp
+	json.Unmarshal(resp.Body, &versions)
+	if 0 != resp.Code || 2 != len(versions.Versions) || 2 != versions.Versions[0].Version ||
+		2 != len(versions.Versions[0].Books) {
+		t.Errorf("POST /books versions: got %+v %+v", resp, versions.Versions)
+	}
+
+	resp = doAdminRequest(t, BookMgrsProc, "/books", `{"action":"diff","body":{"clazz":"fprecommend","from":1,"to":2}}`, "admin-key")
+	var diff recommendDiffResp
+	json.Unmarshal(resp.Body, &diff)
+	if 0 != resp.Code || 1 != len(diff.Diff.Added) || "3" != diff.Diff.Added[0].Id ||
+		1 != len(diff.Diff.Removed) || "1" != diff.Diff.Removed[0].Id {
+		t.Errorf("POST /books diff: got %+v %+v", resp, diff.Diff)
+	}
+
+	resp = doAdminRequest(t, BookMgrsProc, "/books", `{"action":"rollback","body":{"clazz":"fprecommend","version":1}}`, "admin-key")
+	var v recommendVersionResp
+	json.Unmarshal(resp.Body, &v)
+	if 0 != resp.Code || 3 != v.Version.Version || 1 != v.Version.RollbackOf {
+		t.Errorf("POST /books rollback: got %+v %+v", resp, v.Version)
+	}
+	books, _ := mgr.QueryBooksList("fprecommend", "default", false, 0)
+	if !equalIds(books, "1", "2") {
+		t.Errorf("fprecommend after rollback: got %v", bookIds(books))
+	}
+
+	invalid := []struct {
+		body string
+		key  string
+		code int
+	}{
+		{`{"action":"rollback","body":{"clazz":"fprecommend","version":9}}`, "admin-key", -3},
+		{`{"action":"diff","body":{"clazz":"unknown","from":1,"to":2}}`, "admin-key", -3},
+		{`{"action":"x","body":{}}`, "admin-key", -3},
+		{`{"action":"versions","body":{"clazz":"fprecommend"}}`, "editor-key", -5},
+		{`{"action":"rollback","body":{"clazz":"fprecommend","version":1}}`, "editor-key", -5},
+	}
+	for _, c := range invalid {
+		if resp = doAdminRequest(t, BookMgrsProc, "/books", c.body, c.key); c.code != resp.Code {
+			t.Errorf("POST /books %s: expected %d, got %+v", c.body, c.code, resp)
+		}
+	}
+}
+
+func setTestRecommendLists(lists []RecommendListCfg) func() {
+	old := cfg.RecommendLists
+	cfg.RecommendLists = lists
+	return func() {
+		cfg.RecommendLists = old
+	}
+}
+
+func TestConfiguredRecommendList(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	defer setTestRecommendLists([]RecommendListCfg{
+		{Name: "holiday", Table: "holiday_recommend_books", Gender: "girl", Notes: true, MaxSize: 2},
+		{Name: "weekly", Table: "weekly_recommend_books", Editor: true},
+		{Name: "hostile", Table: "x`; drop table `books_table"},
+	})()
+
+	body := `{"action":"set","body":{"clazz":"holiday","books":[{"id":"3","rwords":"好看","ruser":"橘猫"}]}}`
+	if resp := doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key"); 0 != resp.Code {
+		t.Fatalf("POST /books holiday: got %+v", resp)
+	}
+
+	// The list is scoped to girls, whatever gender the client asks for.
+	var list booksListResp
+	resp := doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=holiday&g=boy", "", &list)
+	if 0 != resp.Code || !equalIds(list.Books, "3") || "好看" != list.Books[0].RWords {
+		t.Errorf("GET /books holiday: got %+v %+v", resp, list.Books)
+	}
+
+	detail, _ := mgr.GetBookDetail("3")
+	if !equalStrings(detail.RecommendLists, "holiday") {
+		t.Errorf("GetBookDetail: got %v", detail.RecommendLists)
+	}
+
+	cases := []struct {
+		body string
+		key  string
+		code int
+	}{
+		{`{"action":"set","body":{"clazz":"holiday","books":[{"id":"1"}]}}`, "admin-key", -3},
+		{`{"action":"set","body":{"clazz":"holiday","books":[{"id":"1","rwords":"a","ruser":"b"}]}}`, "admin-key", -3},
+		{`{"action":"set","body":{"clazz":"holiday","books":[` +
+			`{"id":"1","rwords":"a","ruser":"b"},{"id":"2","rwords":"a","ruser":"b"},{"id":"3","rwords":"a","ruser":"b"}]}}`,
+			"admin-key", -3},
+		{`{"action":"set","body":{"clazz":"hostile","books":[{"id":"1"}]}}`, "admin-key", -3},
+		{`{"action":"set","body":{"clazz":"fprecommend","books":[{"id":"1"}]}}`, "admin-key", -3},
+		{`{"action":"set","body":{"clazz":"holiday","books":[{"id":"1","rwords":"a","ruser":"b"}]}}`, "editor-key", -5},
+		{`{"action":"set","body":{"clazz":"weekly","books":[{"id":"1"}]}}`, "editor-key", 0},
+	}
+	for _, c := range cases {
+		if resp = doAdminRequest(t, BookMgrsProc, "/books", c.body, c.key); c.code != resp.Code {
+			t.Errorf("POST /books %s: expected %d, got %+v", c.body, c.code, resp)
+		}
+	}
+	resp = doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=weekly", "", &list)
+	if 0 != resp.Code || !equalIds(list.Books, "1") {
+		t.Errorf("GET /books weekly: got %+v %+v", resp, list.Books)
+	}
+}
+
+func TestRecommendListGender(t *testing.T) {
+	if err := validateRecommendLists([]RecommendListCfg{{Name: "a", Table: "a"},
+		{Name: "b", Table: "b", Gender: "girl"}}); nil != err {
+		t.Errorf("validateRecommendLists: got %v", err)
+	}
+	for _, gender := range []string{"boy", "default", "Girl"} {
+		lists := []RecommendListCfg{{Name: "scoped", Table: "scoped_recommend_books", Gender: gender}}
+		if err := validateRecommendLists(lists); nil == err {
+			t.Errorf("validateRecommendLists(%s): expected error", gender)
+		}
+	}
+
+	// An unscoped list keeps the gender the client asks for.
+	setTestBookMgr(t)
+	setTestRecommend(t, map[string]interface{}{"clazz": "girlrecommend", "books": fpBooks("1", "3")})
+	books, err := mgr.QueryBooksList("girlrecommend", "girl", false, 0)
+	if nil != err || !equalIds(books, "3") {
+		t.Errorf("QueryBooksList(girlrecommend, girl): got %v %v", bookIds(books), err)
+	}
+	books, _ = mgr.QueryBooksList("girlrecommend", "boy", false, 0)
+	if !equalIds(books, "1", "3") {
+		t.Errorf("QueryBooksList(girlrecommend, boy): got %v", bookIds(books))
+	}
+}
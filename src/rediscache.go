@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/go-redis/redis/v7"
+	"kkt.com/glog"
+	"time"
+)
+
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(cfg *RedisCfg) (*RedisCache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		DB:       cfg.Db,
+	})
+	err := client.Ping().Err()
+	if nil != err {
+		client.Close()
+		return nil, err
+	}
+	return &RedisCache{client: client}, nil
+}
+
+func (c *RedisCache) Get(key string) ([]byte, bool) {
+	value, err := c.client.Get(key).Bytes()
+	if nil != err {
+		if redis.Nil != err {
+			glog.Warning(err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) {
+	err := c.client.Set(key, value, ttl).Err()
+	if nil != err {
+		glog.Warning(err)
+	}
+}
+
+func (c *RedisCache) DeletePrefix(prefix string) {
+	iter := c.client.Scan(0, prefix+"*", 100).Iterator()
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); nil != err {
+		glog.Warning(err)
+	}
+	if 0 == len(keys) {
+		return
+	}
+	err := c.client.Del(keys...).Err()
+	if nil != err {
+		glog.Warning(err)
+	}
+}
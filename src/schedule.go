@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"kkt.com/glog"
+	"time"
+)
+
+const defaultScheduleInterval = 30
+
+const (
+	schedulePending   = "pending"
+	schedulePublished = "published"
+	scheduleExpired   = "expired"
+	scheduleCancelled = "cancelled"
+)
+
+type RecommendSchedule struct {
+	Id        int64           `json:"id"`
+	Clazz     string          `json:"clazz"`
+	Author    string          `json:"author"`
+	PublishAt int64           `json:"publish_at"`
+	ExpireAt  int64           `json:"expire_at,omitempty"`
+	State     string          `json:"state"`
+	Version   int             `json:"version,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+	Books     []recommendBook `json:"books"`
+}
+
+func (mgr *BookMgr) latestRecommendVersion(clazz string) (int, error) {
+	versions, err := mgr.store.QueryRecommendVersions(clazz, 0, 1)
+	if nil != err || 0 == len(versions) {
+		return 0, err
+	}
+	return versions[0].Version, nil
+}
+
+func (mgr *BookMgr) scheduleBooks(admin *AdminKeyCfg, p *recommendP) (*RecommendVersion, *RecommendSchedule, error) {
+	now := time.Now().Unix()
+	if 0 < p.ExpireAt && (p.ExpireAt <= p.PublishAt || p.ExpireAt <= now) {
+		return nil, nil, errors.New("Invalid parameter")
+	}
+	if p.PublishAt <= now && 0 == p.ExpireAt {
+		version, err := mgr.setRecommendList(admin, p.Clazz, p.Books, 0)
+		return version, nil, err
+	}
+
+	schedule := RecommendSchedule{
+		Clazz:     p.Clazz,
+		Author:    admin.Name,
+		PublishAt: p.PublishAt,
+		ExpireAt:  p.ExpireAt,
+		State:     schedulePending,
+		CreatedAt: now,
+		Books:     uniqueRecommendBooks(p.Books),
+	}
+	if schedule.PublishAt < now {
+		schedule.PublishAt = now
+	}
+	err := mgr.store.AddRecommendSchedule(&schedule)
+	if nil != err {
+		return nil, nil, err
+	}
+	if schedule.PublishAt > now {
+		return nil, &schedule, nil
+	}
+
+	version, err := mgr.publishSchedule(&schedule)
+	return version, &schedule, err
+}
+
+// A list filled before versioning has no version to fall back to, keep what
+// it holds now as one.
+func (mgr *BookMgr) snapshotRecommendList(clazz string) error {
+	latest, err := mgr.latestRecommendVersion(clazz)
+	if nil != err || 0 < latest {
+		return err
+	}
+	list := findRecommendList(clazz)
+	if nil == list {
+		return errors.New("Unknown recommend list " + clazz)
+	}
+	current, err := mgr.store.QueryRecommendBooks(list.Table, list.Notes, BookFilter{})
+	if nil != err {
+		return err
+	}
+	books := make([]recommendBook, 0, len(current))
+	for _, book := range current {
+		books = append(books, recommendBook{Id: book.Id, RWords: book.RWords, RUser: book.RUser})
+	}
+	_, err = mgr.setRecommendList(systemAdmin, clazz, books, 0)
+	return err
+}
+
+func (mgr *BookMgr) publishSchedule(schedule *RecommendSchedule) (*RecommendVersion, error) {
+	// Claim the schedule first so that only one server publishes it.
+	schedule.State = schedulePublished
+	ok, err := mgr.store.UpdateRecommendSchedule(schedule, schedulePending)
+	if nil != err || !ok {
+		return nil, err
+	}
+	err = mgr.snapshotRecommendList(schedule.Clazz)
+	if nil != err {
+		schedule.State = schedulePending
+		mgr.store.UpdateRecommendSchedule(schedule, schedulePublished)
+		return nil, err
+	}
+
+	author := &AdminKeyCfg{Name: schedule.Author, Role: roleAdmin}
+	version, err := mgr.setRecommendList(author, schedule.Clazz, schedule.Books, 0)
+	if nil != err {
+		schedule.State = schedulePending
+		mgr.store.UpdateRecommendSchedule(schedule, schedulePublished)
+		return nil, err
+	}
+	schedule.Version = version.Version
+	_, err = mgr.store.UpdateRecommendSchedule(schedule, schedulePublished)
+	return version, err
+}
+
+const schedulePageSize = 100
+
+func (mgr *BookMgr) allRecommendSchedules(clazz string) ([]*RecommendSchedule, error) {
+	schedules := make([]*RecommendSchedule, 0)
+	for offset := 0; ; offset += schedulePageSize {
+		page, err := mgr.store.QueryRecommendSchedules(clazz, offset, schedulePageSize)
+		if nil != err {
+			return nil, err
+		}
+		schedules = append(schedules, page...)
+		if len(page) < schedulePageSize {
+			return schedules, nil
+		}
+	}
+}
+
+func (mgr *BookMgr) allRecommendVersions(clazz string) ([]*RecommendVersion, error) {
+	versions := make([]*RecommendVersion, 0)
+	for offset := 0; ; offset += schedulePageSize {
+		page, err := mgr.store.QueryRecommendVersions(clazz, offset, schedulePageSize)
+		if nil != err {
+			return nil, err
+		}
+		versions = append(versions, page...)
+		if len(page) < schedulePageSize {
+			return versions, nil
+		}
+	}
+}
+
+func unscheduledVersion(versions []*RecommendVersion, schedules []*RecommendSchedule) *RecommendVersion {
+	scheduled := make(map[int]bool)
+	for _, schedule := range schedules {
+		if 0 < schedule.Version {
+			scheduled[schedule.Version] = true
+		}
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if 0 < versions[i].RollbackOf && scheduled[versions[i].RollbackOf] {
+			scheduled[versions[i].Version] = true
+		}
+	}
+	for _, version := range versions {
+		if !scheduled[version.Version] {
+			return version
+		}
+	}
+	return nil
+}
+
+func (mgr *BookMgr) expireSchedule(schedule *RecommendSchedule) error {
+	schedule.State = scheduleExpired
+	ok, err := mgr.store.UpdateRecommendSchedule(schedule, schedulePublished)
+	if nil != err || !ok {
+		return err
+	}
+
+	schedules, err := mgr.allRecommendSchedules(schedule.Clazz)
+	if nil != err {
+		return err
+	}
+	versions, err := mgr.allRecommendVersions(schedule.Clazz)
+	if nil != err {
+		return err
+	}
+
+	// An overlapping schedule still live keeps its list, the newest one wins.
+	var target *RecommendVersion
+	live := 0
+	for _, s := range schedules {
+		if schedulePublished == s.State && s.Id != schedule.Id && s.Version > live {
+			live = s.Version
+		}
+	}
+	if 0 < live {
+		for _, version := range versions {
+			if live == version.Version {
+				target = version
+			}
+		}
+	} else {
+		target = unscheduledVersion(versions, schedules)
+	}
+
+	if nil == target {
+		glog.Warning("No recommend list to fall back to, keep ", schedule.Clazz, " of schedule ", schedule.Id)
+		return nil
+	}
+	if target.Version == versions[0].Version {
+		return nil
+	}
+	_, err = mgr.setRecommendList(systemAdmin, schedule.Clazz, target.Books, target.Version)
+	return err
+}
+
+func (mgr *BookMgr) RunSchedules(now time.Time) error {
+	mgr.scheduleMutex.Lock()
+	defer mgr.scheduleMutex.Unlock()
+
+	schedules, err := mgr.store.QueryDueRecommendSchedules(now.Unix())
+	if nil != err {
+		return err
+	}
+	for _, schedule := range schedules {
+		switch {
+		case schedulePending == schedule.State && 0 < schedule.ExpireAt && schedule.ExpireAt <= now.Unix():
+			schedule.State = scheduleExpired
+			_, err = mgr.store.UpdateRecommendSchedule(schedule, schedulePending)
+		case schedulePending == schedule.State:
+			_, err = mgr.publishSchedule(schedule)
+		default:
+			err = mgr.expireSchedule(schedule)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mgr *BookMgr) QueryRecommendSchedules(admin *AdminKeyCfg, body interface{}) ([]*RecommendSchedule, error) {
+	p, err := parseRecommendVersionBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	if 0 > p.Offset {
+		p.Offset = 0
+	}
+	if 0 >= p.Limit {
+		p.Limit = mgr.PageCount
+	}
+	return mgr.store.QueryRecommendSchedules(p.Clazz, p.Offset, p.Limit)
+}
+
+func (mgr *BookMgr) CancelRecommendSchedule(admin *AdminKeyCfg, body interface{}) (*RecommendSchedule, error) {
+	p, err := parseRecommendVersionBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	schedule, err := mgr.store.GetRecommendSchedule(p.Id)
+	if nil != err {
+		return nil, err
+	}
+	if nil == schedule || p.Clazz != schedule.Clazz {
+		return nil, errors.New("Invalid parameter")
+	}
+	from := schedule.State
+	schedule.State = scheduleCancelled
+	ok, err := mgr.store.UpdateRecommendSchedule(schedule, schedulePending)
+	if nil != err {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("Schedule is " + from)
+	}
+	return schedule, nil
+}
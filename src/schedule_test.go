@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func setTestRecommend(t *testing.T, body map[string]interface{}) (*RecommendVersion, *RecommendSchedule) {
+	version, schedule, err := mgr.SetBooks(systemAdmin, "", body)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return version, schedule
+}
+
+func fpBooks(ids ...string) []map[string]string {
+	books := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		books = append(books, map[string]string{"id": id})
+	}
+	return books
+}
+
+func assertFpRecommend(t *testing.T, step string, ids ...string) {
+	books, err := mgr.QueryBooksList("fprecommend", "default", false, 0)
+	if nil != err || !equalIds(books, ids...) {
+		t.Errorf("%s: expected %v, got %v %v", step, ids, bookIds(books), err)
+	}
+}
+
+func TestSchedulePublishAndExpire(t *testing.T) {
+	setTestBookMgr(t)
+	now := time.Now()
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("1")})
+
+	_, schedule := setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("2", "3"),
+		"publish_at": now.Unix() + 100, "expire_at": now.Unix() + 200})
+	if nil == schedule || schedulePending != schedule.State {
+		t.Fatalf("SetBooks scheduled: got %+v", schedule)
+	}
+	assertFpRecommend(t, "before publish", "1")
+
+	mgr.RunSchedules(now.Add(50 * time.Second))
+	assertFpRecommend(t, "not due", "1")
+
+	mgr.RunSchedules(now.Add(100 * time.Second))
+	assertFpRecommend(t, "published", "2", "3")
+
+	mgr.RunSchedules(now.Add(200 * time.Second))
+	assertFpRecommend(t, "expired", "1")
+
+	versions, _ := mgr.store.QueryRecommendVersions("fprecommend", 0, 10)
+	if 3 != len(versions) || 1 != versions[0].RollbackOf {
+		t.Errorf("versions after expiry: got %+v", versions)
+	}
+	schedule, _ = mgr.store.GetRecommendSchedule(schedule.Id)
+	if scheduleExpired != schedule.State || 2 != schedule.Version {
+		t.Errorf("schedule after expiry: got %+v", schedule)
+	}
+}
+
+func TestScheduleExpireKeepsNewerList(t *testing.T) {
+	setTestBookMgr(t)
+	now := time.Now()
+	version, schedule := setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend",
+		"books": fpBooks("2"), "expire_at": now.Unix() + 100})
+	if nil == version || nil == schedule || schedulePublished != schedule.State {
+		t.Fatalf("SetBooks with expiry: got %+v %+v", version, schedule)
+	}
+	assertFpRecommend(t, "published now", "2")
+
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("3")})
+	mgr.RunSchedules(now.Add(100 * time.Second))
+	assertFpRecommend(t, "replaced before expiry", "3")
+}
+
+func TestScheduleExpireNestedOverlap(t *testing.T) {
+	setTestBookMgr(t)
+	now := time.Now()
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("1")})
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("2"),
+		"publish_at": now.Unix() + 100, "expire_at": now.Unix() + 400})
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("3"),
+		"publish_at": now.Unix() + 200, "expire_at": now.Unix() + 300})
+
+	mgr.RunSchedules(now.Add(200 * time.Second))
+	assertFpRecommend(t, "inner published", "3")
+	mgr.RunSchedules(now.Add(300 * time.Second))
+	assertFpRecommend(t, "inner expired", "2")
+	mgr.RunSchedules(now.Add(400 * time.Second))
+	assertFpRecommend(t, "outer expired", "1")
+}
+
+func TestScheduleExpireStaggeredOverlap(t *testing.T) {
+	setTestBookMgr(t)
+	now := time.Now()
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("1")})
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("2"),
+		"publish_at": now.Unix() + 100, "expire_at": now.Unix() + 300})
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("3"),
+		"publish_at": now.Unix() + 200, "expire_at": now.Unix() + 400})
+
+	mgr.RunSchedules(now.Add(200 * time.Second))
+	assertFpRecommend(t, "second published", "3")
+	mgr.RunSchedules(now.Add(300 * time.Second))
+	assertFpRecommend(t, "first expired", "3")
+	mgr.RunSchedules(now.Add(400 * time.Second))
+	assertFpRecommend(t, "second expired", "1")
+}
+
+func TestScheduleExpireUnversionedList(t *testing.T) {
+	store := setTestBookMgr(t)
+	now := time.Now()
+	store.SetRecommendBooks("main_recommend_books", false, []recommendBook{{Id: "1"}, {Id: "3"}}, nil)
+
+	setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend",
+		"books": fpBooks("2"), "expire_at": now.Unix() + 100})
+	assertFpRecommend(t, "published", "2")
+	mgr.RunSchedules(now.Add(100 * time.Second))
+	assertFpRecommend(t, "expired to the list from before versioning", "1", "3")
+}
+
+func TestScheduleExpireWithoutFallback(t *testing.T) {
+	store := setTestBookMgr(t)
+	now := time.Now()
+	version := RecommendVersion{Clazz: "fprecommend", Author: "root", Books: []recommendBook{{Id: "2"}}}
+	store.SetRecommendBooks("main_recommend_books", false, version.Books, &version)
+	schedule := RecommendSchedule{Clazz: "fprecommend", Author: "root", PublishAt: now.Unix(),
+		ExpireAt: now.Unix() + 100, State: schedulePublished, Version: version.Version, Books: version.Books}
+	store.AddRecommendSchedule(&schedule)
+
+	mgr.RunSchedules(now.Add(100 * time.Second))
+	assertFpRecommend(t, "no list to fall back to", "2")
+	expired, _ := store.GetRecommendSchedule(schedule.Id)
+	if scheduleExpired != expired.State {
+		t.Errorf("schedule without fallback: got %+v", expired)
+	}
+}
+
+func TestScheduleCancelAndInvalid(t *testing.T) {
+	setTestBookMgr(t)
+	defer setTestAdminKeys()()
+	now := time.Now()
+	_, missed := setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("1"),
+		"publish_at": now.Unix() + 10, "expire_at": now.Unix() + 20})
+	_, cancelled := setTestRecommend(t, map[string]interface{}{"clazz": "fprecommend", "books": fpBooks("2"),
+		"publish_at": now.Unix() + 10})
+
+	schedule, err := mgr.CancelRecommendSchedule(systemAdmin, map[string]interface{}{"clazz": "fprecommend", "id": cancelled.Id})
+	if nil != err || scheduleCancelled != schedule.State {
+		t.Fatalf("CancelRecommendSchedule: got %+v %v", schedule, err)
+	}
+	if _, err = mgr.CancelRecommendSchedule(systemAdmin, map[string]interface{}{"clazz": "fprecommend", "id": cancelled.Id}); nil == err {
+		t.Error("CancelRecommendSchedule twice: expected error")
+	}
+
+	// The server was down for the whole window of the first schedule.
+	mgr.RunSchedules(now.Add(30 * time.Second))
+	assertFpRecommend(t, "missed and cancelled")
+	schedule, _ = mgr.store.GetRecommendSchedule(missed.Id)
+	if scheduleExpired != schedule.State || 0 != schedule.Version {
+		t.Errorf("missed schedule: got %+v", schedule)
+	}
+
+	resp := doAdminRequest(t, BookMgrsProc, "/books", `{"action":"schedules","body":{"clazz":"fprecommend"}}`, "admin-key")
+	if 0 != resp.Code {
+		t.Errorf("POST /books schedules: got %+v", resp)
+	}
+	for _, body := range []map[string]interface{}{
+		{"clazz": "fprecommend", "books": fpBooks("1"), "publish_at": now.Unix() + 20, "expire_at": now.Unix() + 10},
+		{"clazz": "fprecommend", "books": fpBooks("1"), "expire_at": now.Unix() - 10},
+	} {
+		if _, _, err = mgr.SetBooks(systemAdmin, "", body); nil == err {
+			t.Errorf("SetBooks %v: expected error", body)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	sortRelevance = "relevance"
+	sortScore     = "score"
+	sortReads     = "reads"
+	sortVotes     = "votes"
+	sortRecency   = "recency"
+
+	facetGender   = "gender"
+	facetFinished = "finished"
+	facetClass    = "class"
+	facetVIP      = "vip"
+
+	maxFallbackResults = 1000
+)
+
+var updateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+type SearchFilter struct {
+	Gender       string `json:"gender,omitempty"`
+	Finished     *bool  `json:"finished,omitempty"`
+	Class        string `json:"class,omitempty"`
+	MinChars     int    `json:"min_chars,omitempty"`
+	MaxChars     int    `json:"max_chars,omitempty"`
+	UpdatedSince string `json:"updated_since,omitempty"`
+	VIP          bool   `json:"vip,omitempty"`
+	Sort         string `json:"sort"`
+
+	since time.Time
+}
+
+type SearchFacets struct {
+	Gender   map[string]int `json:"gender"`
+	Finished map[string]int `json:"finished"`
+	Class    map[string]int `json:"class"`
+	VIP      map[string]int `json:"vip"`
+}
+
+func parseUpdateTime(value string) (time.Time, bool) {
+	for _, layout := range updateTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if nil == err {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseSearchFilter(r *http.Request) (*SearchFilter, error) {
+	var filter SearchFilter
+	var err error
+
+	// g and f keep their meaning on book lists, gender and finished are strict.
+	if 0 < len(r.Form["g"]) && "girl" == r.Form["g"][0] {
+		filter.Gender = "girl"
+	}
+	if 0 < len(r.Form["f"]) && "true" == r.Form["f"][0] {
+		finished := true
+		filter.Finished = &finished
+	}
+
+	if 0 < len(r.Form["gender"]) && "" != r.Form["gender"][0] {
+		gender := r.Form["gender"][0]
+		if "boy" != gender && "girl" != gender {
+			return nil, errors.New("Invalid gender")
+		}
+		filter.Gender = gender
+	}
+	if 0 < len(r.Form["finished"]) && "" != r.Form["finished"][0] {
+		finished, err := strconv.ParseBool(r.Form["finished"][0])
+		if nil != err {
+			return nil, err
+		}
+		filter.Finished = &finished
+	}
+
+	if 0 < len(r.Form["class"]) {
+		filter.Class = r.Form["class"][0]
+	}
+
+	filter.MinChars, err = formIntValue(r, "min_chars", 0)
+	if nil != err {
+		return nil, err
+	}
+	filter.MaxChars, err = formIntValue(r, "max_chars", 0)
+	if nil != err {
+		return nil, err
+	}
+	if 0 > filter.MinChars || 0 > filter.MaxChars ||
+		(0 < filter.MaxChars && filter.MinChars > filter.MaxChars) {
+		return nil, errors.New("Invalid word count range")
+	}
+
+	if 0 < len(r.Form["updated_since"]) && "" != r.Form["updated_since"][0] {
+		since, ok := parseUpdateTime(r.Form["updated_since"][0])
+		if !ok {
+			return nil, errors.New("Invalid updated_since")
+		}
+		filter.UpdatedSince = r.Form["updated_since"][0]
+		filter.since = since
+	}
+
+	if 0 < len(r.Form["vip"]) {
+		filter.VIP = "true" == r.Form["vip"][0]
+	}
+
+	filter.Sort = sortRelevance
+	if 0 < len(r.Form["sort"]) && "" != r.Form["sort"][0] {
+		filter.Sort = r.Form["sort"][0]
+	}
+	switch filter.Sort {
+	case sortRelevance, sortScore, sortReads, sortVotes, sortRecency:
+	default:
+		return nil, errors.New("Invalid sort")
+	}
+
+	return &filter, nil
+}
+
+func (f *SearchFilter) cacheKey() string {
+	finished := ""
+	if nil != f.Finished {
+		finished = strconv.FormatBool(*f.Finished)
+	}
+	return fmt.Sprintf("%s:%s:%d:%d:%s:%t:%s:%s", f.Gender, finished,
+		f.MinChars, f.MaxChars, f.UpdatedSince, f.VIP, f.Sort, f.Class)
+}
+
+func (f *SearchFilter) match(book *Book, skip string) bool {
+	if facetGender != skip && "" != f.Gender && f.Gender != book.Gender {
+		return false
+	}
+	if facetFinished != skip && nil != f.Finished && *f.Finished != book.Finished {
+		return false
+	}
+	if facetClass != skip && "" != f.Class && f.Class != book.Class {
+		return false
+	}
+	if facetVIP != skip && f.VIP && !book.WithVIPChapter {
+		return false
+	}
+	if 0 < f.MinChars && book.TotalChars < f.MinChars {
+		return false
+	}
+	if 0 < f.MaxChars && book.TotalChars > f.MaxChars {
+		return false
+	}
+	if "" != f.UpdatedSince {
+		updated, ok := parseUpdateTime(book.LastUpdateTime)
+		if !ok || updated.Before(f.since) {
+			return false
+		}
+	}
+	return true
+}
+
+func countFacet(counts map[string]int, value string) {
+	if "" != value {
+		counts[value]++
+	}
+}
+
+func (f *SearchFilter) facets(books []*Book) *SearchFacets {
+	facets := &SearchFacets{
+		Gender:   make(map[string]int),
+		Finished: make(map[string]int),
+		Class:    make(map[string]int),
+		VIP:      make(map[string]int),
+	}
+	for _, book := range books {
+		if f.match(book, facetGender) {
+			countFacet(facets.Gender, book.Gender)
+		}
+		if f.match(book, facetFinished) {
+			countFacet(facets.Finished, strconv.FormatBool(book.Finished))
+		}
+		if f.match(book, facetClass) {
+			countFacet(facets.Class, book.Class)
+		}
+		if f.match(book, facetVIP) {
+			countFacet(facets.VIP, strconv.FormatBool(book.WithVIPChapter))
+		}
+	}
+	return facets
+}
+
+// Books come in relevance order, the stable sort keeps it for ties.
+func (f *SearchFilter) apply(books []*Book) []*Book {
+	filtered := make([]*Book, 0, len(books))
+	for _, book := range books {
+		if f.match(book, "") {
+			filtered = append(filtered, book)
+		}
+	}
+
+	var less func(a *Book, b *Book) bool
+	switch f.Sort {
+	case sortScore:
+		less = func(a *Book, b *Book) bool { return a.Score > b.Score }
+	case sortReads:
+		less = func(a *Book, b *Book) bool { return a.TotalReads > b.TotalReads }
+	case sortVotes:
+		less = func(a *Book, b *Book) bool { return a.TotalVotes > b.TotalVotes }
+	case sortRecency:
+		less = func(a *Book, b *Book) bool {
+			ta, _ := parseUpdateTime(a.LastUpdateTime)
+			tb, _ := parseUpdateTime(b.LastUpdateTime)
+			return ta.After(tb)
+		}
+	}
+	if nil != less {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return less(filtered[i], filtered[j])
+		})
+	}
+	return filtered
+}
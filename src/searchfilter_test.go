@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func setTestSearchBooks(t *testing.T) {
+	store := setTestBookMgr(t)
+	store.AddBook(&Book{Id: "4", Name: "剑来", Author: "烽火戏诸侯", Class: "玄幻", Gender: "boy",
+		TotalChars: 3000000, LastUpdateTime: "2026-10-01 08:00:00", WithVIPChapter: true,
+		Score: 90, TotalReads: 50, TotalVotes: 3})
+	store.AddBook(&Book{Id: "5", Name: "剑王朝", Author: "无罪", Class: "玄幻", Gender: "boy",
+		Finished: true, TotalChars: 1000000, LastUpdateTime: "2020-01-01 10:00:00",
+		Score: 80, TotalReads: 70, TotalVotes: 1})
+	store.AddBook(&Book{Id: "6", Name: "剑仙在此", Author: "乱世狂刀", Class: "仙侠", Gender: "girl",
+		Finished: true, TotalChars: 2000000, LastUpdateTime: "2026-09-01", WithVIPChapter: true,
+		Score: 70, TotalReads: 10, TotalVotes: 9})
+	err := mgr.RebuildSearchIndex()
+	if nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	setTestSearchBooks(t)
+
+	cases := []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"4", "5", "6"}},
+		{"&g=boy&f=false", []string{"4", "5", "6"}},
+		{"&g=girl", []string{"6"}},
+		{"&f=true", []string{"5", "6"}},
+		{"&gender=boy&finished=true", []string{"5"}},
+		{"&g=girl&gender=boy", []string{"4", "5"}},
+		{"&finished=false", []string{"4"}},
+		{"&class=仙侠", []string{"6"}},
+		{"&min_chars=1500000&max_chars=3000000", []string{"4", "6"}},
+		{"&updated_since=2026-01-01", []string{"4", "6"}},
+		{"&vip=true", []string{"4", "6"}},
+		{"&g=default&vip=true&class=玄幻", []string{"4"}},
+		{"&sort=score", []string{"4", "5", "6"}},
+		{"&sort=reads", []string{"5", "4", "6"}},
+		{"&sort=votes", []string{"6", "4", "5"}},
+		{"&sort=recency", []string{"4", "6", "5"}},
+	}
+	for _, c := range cases {
+		var result booksSearchResp
+		resp := doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=剑"+c.query, "", &result)
+		if 0 != resp.Code || len(c.ids) != result.TotalCount || !equalIds(result.Books, c.ids...) {
+			t.Errorf("search %s: got %d %d %v", c.query, resp.Code, result.TotalCount, bookIds(result.Books))
+		}
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	setTestSearchBooks(t)
+
+	var result booksSearchResp
+	doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=剑&gender=boy&f=true&sort=reads", "", &result)
+	finished := true
+	expectFilter := SearchFilter{Gender: "boy", Finished: &finished, Sort: sortReads}
+	if nil == result.Filter || !reflect.DeepEqual(*result.Filter, expectFilter) {
+		t.Errorf("filter: got %+v", result.Filter)
+	}
+
+	expect := SearchFacets{
+		Gender:   map[string]int{"boy": 1, "girl": 1},
+		Finished: map[string]int{"true": 1, "false": 1},
+		Class:    map[string]int{"玄幻": 1},
+		VIP:      map[string]int{"false": 1},
+	}
+	if nil == result.Facets || !reflect.DeepEqual(*result.Facets, expect) {
+		t.Errorf("facets: got %+v", result.Facets)
+	}
+}
+
+func TestSearchFiltersInvalid(t *testing.T) {
+	setTestSearchBooks(t)
+
+	for _, query := range []string{
+		"&sort=random",
+		"&finished=maybe",
+		"&gender=other",
+		"&min_chars=5&max_chars=1",
+		"&min_chars=-1",
+		"&updated_since=yesterday",
+	} {
+		resp := doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=剑"+query, "", nil)
+		if -2 != resp.Code {
+			t.Errorf("search %s: expected -2, got %d", query, resp.Code)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	defaultIndexRefresh = 600
+	indexBuildBatch     = 1000
+)
+
+const (
+	weightName         = 8
+	weightAuthor       = 6
+	weightAbbreviation = 4
+	weightClass        = 2
+)
+
+const (
+	bonusExactName   = 100
+	bonusExactAuthor = 60
+	bonusNamePrefix  = 30
+)
+
+type indexedBook struct {
+	book         *Book
+	name         string
+	author       string
+	tokens       []string
+	namePinyin   pinyinText
+	authorPinyin pinyinText
+}
+
+type SearchIndex struct {
+	mutex    sync.RWMutex
+	ready    bool
+	books    map[string]*indexedBook
+	postings map[string]map[string]int
+
+	hotWords    []string
+	suggestions map[rune][]*suggestEntry
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		books:    make(map[string]*indexedBook),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// Terms must all match, bigrams only improve the ranking.
+func searchTokens(text string) ([]string, []string) {
+	terms := make([]string, 0)
+	bigrams := make([]string, 0)
+
+	var word []rune
+	var prev rune
+	flushWord := func() {
+		if 0 < len(word) {
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isHan(r):
+			flushWord()
+			terms = append(terms, string(r))
+			if 0 != prev {
+				bigrams = append(bigrams, string([]rune{prev, r}))
+			}
+			prev = r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+			prev = 0
+		default:
+			flushWord()
+			prev = 0
+		}
+	}
+	flushWord()
+
+	return terms, bigrams
+}
+
+type indexField struct {
+	text   string
+	weight int
+}
+
+func bookIndexFields(book *Book) []indexField {
+	return []indexField{
+		{book.Name, weightName},
+		{book.Author, weightAuthor},
+		{book.Abbreviation, weightAbbreviation},
+		{book.Class, weightClass},
+	}
+}
+
+func (index *SearchIndex) removeLocked(id string) {
+	doc, ok := index.books[id]
+	if !ok {
+		return
+	}
+	for _, token := range doc.tokens {
+		posting := index.postings[token]
+		delete(posting, id)
+		if 0 == len(posting) {
+			delete(index.postings, token)
+		}
+	}
+	delete(index.books, id)
+	index.suggestions = nil
+}
+
+func (index *SearchIndex) putLocked(book *Book) {
+	index.removeLocked(book.Id)
+
+	weights := make(map[string]int)
+	for _, field := range bookIndexFields(book) {
+		terms, bigrams := searchTokens(field.text)
+		seen := make(map[string]bool)
+		for _, token := range append(terms, bigrams...) {
+			if seen[token] {
+				continue
+			}
+			seen[token] = true
+			weights[token] += field.weight
+		}
+	}
+
+	doc := &indexedBook{
+		book:         book,
+		name:         strings.ToLower(book.Name),
+		author:       strings.ToLower(book.Author),
+		tokens:       make([]string, 0, len(weights)),
+		namePinyin:   newPinyinText(book.Name),
+		authorPinyin: newPinyinText(book.Author),
+	}
+	for token, weight := range weights {
+		posting, ok := index.postings[token]
+		if !ok {
+			posting = make(map[string]int)
+			index.postings[token] = posting
+		}
+		posting[book.Id] = weight
+		doc.tokens = append(doc.tokens, token)
+	}
+	index.books[book.Id] = doc
+	index.suggestions = nil
+}
+
+func (index *SearchIndex) Put(book *Book) {
+	copied := *book
+	index.mutex.Lock()
+	index.putLocked(&copied)
+	index.mutex.Unlock()
+}
+
+func (index *SearchIndex) Remove(id string) {
+	index.mutex.Lock()
+	index.removeLocked(id)
+	index.mutex.Unlock()
+}
+
+func (index *SearchIndex) Replace(books []*Book) {
+	built := NewSearchIndex()
+	for _, book := range books {
+		copied := *book
+		built.putLocked(&copied)
+	}
+
+	index.mutex.Lock()
+	index.books = built.books
+	index.postings = built.postings
+	index.suggestions = nil
+	index.ready = true
+	index.mutex.Unlock()
+}
+
+// Flushed deltas no longer show up as pending, so the indexed copies take them.
+func (index *SearchIndex) AddCounters(books map[string]BookCounters) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	for id, delta := range books {
+		doc, ok := index.books[id]
+		if !ok {
+			continue
+		}
+		doc.book.TotalReads += delta.Reads
+		doc.book.TotalSearches += delta.Searches
+		doc.book.TotalVotes += delta.Votes
+	}
+}
+
+func (index *SearchIndex) Ready() bool {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return index.ready
+}
+
+func (index *SearchIndex) Len() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return len(index.books)
+}
+
+type searchHit struct {
+	book  *Book
+	score int
+}
+
+func (index *SearchIndex) tokenCandidates(terms []string) map[string]int {
+	var candidates map[string]int
+	for _, term := range terms {
+		posting, ok := index.postings[term]
+		if !ok {
+			return nil
+		}
+		if nil == candidates {
+			candidates = make(map[string]int, len(posting))
+			for id, weight := range posting {
+				candidates[id] = weight
+			}
+			continue
+		}
+		for id := range candidates {
+			weight, ok := posting[id]
+			if !ok {
+				delete(candidates, id)
+				continue
+			}
+			candidates[id] += weight
+		}
+	}
+	return candidates
+}
+
+// A blank key matches every book, like the store search does.
+func (index *SearchIndex) Search(key string) []*Book {
+	query := strings.ToLower(strings.TrimSpace(key))
+	terms, bigrams := searchTokens(key)
+	if 0 == len(terms) && "" != query {
+		return make([]*Book, 0)
+	}
+	pinyinKey := pinyinQuery(key)
+
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	relevances := make(map[string]int)
+	if "" == query {
+		for id := range index.books {
+			relevances[id] = 0
+		}
+	}
+	for id, relevance := range index.tokenCandidates(terms) {
+		for _, bigram := range bigrams {
+			relevance += 2 * index.postings[bigram][id]
+		}
+		doc := index.books[id]
+		if query == doc.name {
+			relevance += bonusExactName
+		} else if strings.HasPrefix(doc.name, query) {
+			relevance += bonusNamePrefix
+		}
+		if query == doc.author {
+			relevance += bonusExactAuthor
+		}
+		relevances[id] = relevance
+	}
+	if nil != pinyinKey {
+		for id, doc := range index.books {
+			relevance := doc.pinyinRelevance(pinyinKey)
+			if relevance > relevances[id] {
+				relevances[id] = relevance
+			}
+		}
+	}
+
+	hits := make([]searchHit, 0, len(relevances))
+	for id, relevance := range relevances {
+		hits = append(hits, searchHit{book: index.books[id].book, score: relevance})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		if hits[i].book.Score != hits[j].book.Score {
+			return hits[i].book.Score > hits[j].book.Score
+		}
+		return hits[i].book.Id < hits[j].book.Id
+	})
+
+	books := make([]*Book, 0, len(hits))
+	for _, hit := range hits {
+		copied := *hit.book
+		books = append(books, &copied)
+	}
+	return books
+}
+
+func hotWordsSize() int {
+	if 0 >= cfg.Search.HotWords {
+		return defaultHotWords
+	}
+	return cfg.Search.HotWords
+}
+
+// A flush between reading the books and swapping the index would only reach
+// the old index, so flushes wait for the swap.
+func (mgr *BookMgr) RebuildSearchIndex() error {
+	err := mgr.counters.WithoutFlush(func() error {
+		books := make([]*Book, 0)
+		for offset := 0; ; offset += indexBuildBatch {
+			batch, err := mgr.store.QueryBooks(BookFilter{}, orderById, offset, indexBuildBatch)
+			if nil != err {
+				return err
+			}
+			books = append(books, batch...)
+			if len(batch) < indexBuildBatch {
+				break
+			}
+		}
+		mgr.index.Replace(books)
+		return nil
+	})
+	if nil != err {
+		return err
+	}
+
+	hotWords, err := mgr.store.QueryTopSearchWords(hotWordsSize())
+	if nil != err {
+		return err
+	}
+	mgr.index.SetHotWords(hotWords)
+	mgr.cache.DeletePrefix(searchCachePrefix)
+	return nil
+}
+
+func (mgr *BookMgr) ReindexBook(id string) error {
+	if "" == id {
+		return errors.New("Invalid book id")
+	}
+	book, err := mgr.store.GetBook(id)
+	if nil != err {
+		return err
+	}
+	if nil == book {
+		mgr.index.Remove(id)
+	} else {
+		mgr.index.Put(book)
+	}
+	mgr.cache.DeletePrefix(searchCachePrefix)
+	return nil
+}
+
+type reindexP struct {
+	Id string `json:"id"`
+}
+
+func (mgr *BookMgr) Reindex(admin *AdminKeyCfg, body interface{}) (int, error) {
+	if roleAdmin != admin.Role {
+		return 0, errAdminForbidden
+	}
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return 0, err
+	}
+	var p reindexP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return 0, err
+	}
+
+	if "" == p.Id {
+		err = mgr.RebuildSearchIndex()
+	} else {
+		err = mgr.ReindexBook(p.Id)
+	}
+	return mgr.index.Len(), err
+}
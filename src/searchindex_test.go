@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	terms, bigrams := searchTokens("斗破苍穹 Fresh2-果")
+	if !equalStrings(terms, "斗", "破", "苍", "穹", "fresh2", "果") {
+		t.Errorf("terms: got %v", terms)
+	}
+	if !equalStrings(bigrams, "斗破", "破苍", "苍穹") {
+		t.Errorf("bigrams: got %v", bigrams)
+	}
+}
+
+func TestSearchIndexRanking(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	store.AddBook(&Book{Id: "4", Name: "仙侠奇缘", Author: "某人", Class: "都市", Score: 10})
+	store.AddBook(&Book{Id: "5", Name: "仙侠世界", Author: "某人", Class: "都市", Score: 70})
+	store.AddBook(&Book{Id: "6", Name: "侠客仙踪", Author: "某人", Class: "都市", Score: 99})
+	err := m.RebuildSearchIndex()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	books, count, _, err := m.SearchBooks("仙侠", nil, 0)
+	if nil != err || 4 != count || !equalIds(books, "5", "4", "6", "3") {
+		t.Errorf("SearchBooks(仙侠): got %v %d %v", bookIds(books), count, err)
+	}
+
+	books, _, _, _ = m.SearchBooks("fresh果果", nil, 0)
+	if !equalIds(books, "3") {
+		t.Errorf("SearchBooks(fresh果果): got %v", bookIds(books))
+	}
+
+	books, _, _, _ = m.SearchBooks("仙 武", nil, 0)
+	if 0 != len(books) {
+		t.Errorf("SearchBooks(仙 武): expected all terms to match, got %v", bookIds(books))
+	}
+}
+
+func TestSearchBlankKey(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	for _, ready := range []bool{true, false} {
+		if !ready {
+			m.index = NewSearchIndex()
+		}
+		for _, key := range []string{"", " "} {
+			books, count, _, err := m.SearchBooks(key, nil, 0)
+			if nil != err || 3 != count || !equalIds(books, "2", "1", "3") {
+				t.Errorf("SearchBooks(%q) ready %v: got %v %d %v", key, ready, bookIds(books), count, err)
+			}
+		}
+	}
+}
+
+func TestRebuildSearchIndexTiedScores(t *testing.T) {
+	m, store := newTestBookMgr(t)
+	for i := 0; i < indexBuildBatch; i++ {
+		store.AddBook(&Book{Id: fmt.Sprintf("t%d", i), Name: "同分", Score: 90})
+	}
+	err := m.RebuildSearchIndex()
+	if nil != err || indexBuildBatch+3 != m.index.Len() {
+		t.Errorf("RebuildSearchIndex: got %d books, %v", m.index.Len(), err)
+	}
+}
+
+func TestSearchIndexFallsBackToStore(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	m.index = NewSearchIndex()
+
+	books, count, _, err := m.SearchBooks("忘语", nil, 0)
+	if nil != err || 1 != count || !equalIds(books, "2") {
+		t.Errorf("SearchBooks(忘语): got %v %d %v", bookIds(books), count, err)
+	}
+}
+
+func TestReindexBook(t *testing.T) {
+	store := setTestBookMgr(t)
+	defer setTestAdminKeys()()
+
+	var result booksSearchResp
+	doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=诛仙", "", &result)
+	if 0 != result.TotalCount {
+		t.Fatalf("before add: got %d", result.TotalCount)
+	}
+	store.AddBook(&Book{Id: "4", Name: "诛仙", Author: "萧鼎", Class: "仙侠", Score: 85})
+
+	resp := doAdminRequest(t, BookMgrsProc, "/books", `{"action":"reindex","body":{"id":"4"}}`, "editor-key")
+	if -5 != resp.Code {
+		t.Errorf("reindex as editor: expected -5, got %d", resp.Code)
+	}
+	resp = doAdminRequest(t, BookMgrsProc, "/books", `{"action":"reindex","body":{"id":"4"}}`, "admin-key")
+	if 0 != resp.Code {
+		t.Fatalf("reindex: got %d %s", resp.Code, resp.Error)
+	}
+
+	result = booksSearchResp{}
+	doRequest(t, BookMgrsProc, "GET", "/books?a=s&c=诛仙", "", &result)
+	if 1 != result.TotalCount || !equalIds(result.Books, "4") {
+		t.Errorf("after reindex: got %d %v", result.TotalCount, bookIds(result.Books))
+	}
+
+	resp = doAdminRequest(t, BookMgrsProc, "/books", `{"action":"reindex","body":{}}`, "admin-key")
+	if 0 != resp.Code || 4 != mgr.index.Len() {
+		t.Errorf("full reindex: got %d %s, %d books", resp.Code, resp.Error, mgr.index.Len())
+	}
+}
+
+func TestSearchIndexKeepsFlushedCounters(t *testing.T) {
+	m, _ := newTestBookMgr(t)
+	m.counters.Add("1", BookCounters{Reads: 5, Votes: 2})
+	err := m.FlushCounters()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	books, _, _, err := m.SearchBooks("斗破", nil, 0)
+	if nil != err || 1 != len(books) || 15 != books[0].TotalReads || 5 != books[0].TotalVotes {
+		t.Errorf("SearchBooks(斗破) after flush: got %+v %v", books, err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type ShelfEntry struct {
+	ClientId     string `json:"client_id"`
+	BookId       string `json:"book_id"`
+	Position     int    `json:"position"`
+	AddedAt      int64  `json:"added_at"`
+	OpenedAt     int64  `json:"opened_at"`
+	SeenNativeId int    `json:"seen_native_id"`
+}
+
+type ShelfBook struct {
+	*Book
+	Position    int   `json:"position"`
+	AddedAt     int64 `json:"added_at"`
+	OpenedAt    int64 `json:"opened_at"`
+	NewChapters bool  `json:"new_chapters"`
+}
+
+type shelfReqP struct {
+	ClientId string   `json:"client_id"`
+	Token    string   `json:"token"`
+	BookId   string   `json:"book_id"`
+	BookIds  []string `json:"book_ids"`
+}
+
+func (mgr *BookMgr) parseShelfReqBody(body interface{}) (*shelfReqP, error) {
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return nil, err
+	}
+	var p shelfReqP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return nil, err
+	}
+	p.ClientId, err = mgr.ownerId(p.ClientId, p.Token)
+	if nil != err {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func isShelfRecommend(clazz string) bool {
+	return "shelfrecommend" == clazz
+}
+
+func (mgr *BookMgr) latestNativeId(bookId string) (int, error) {
+	latest, err := mgr.store.GetLatestBookChapter(bookId)
+	if nil != err || nil == latest {
+		return -1, err
+	}
+	return latest.NativeId, nil
+}
+
+func (mgr *BookMgr) GetShelf(clientId string, token string) ([]*ShelfBook, error) {
+	owner, err := mgr.ownerId(clientId, token)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.QueryShelf(owner)
+}
+
+func (mgr *BookMgr) QueryShelf(owner string) ([]*ShelfBook, error) {
+	entries, err := mgr.store.QueryShelfBooks(owner)
+	if nil != err {
+		return nil, err
+	}
+
+	books := make([]*ShelfBook, 0, len(entries))
+	for _, entry := range entries {
+		book, err := mgr.getBook(entry.BookId)
+		if nil != err {
+			return nil, err
+		}
+		if nil == book {
+			continue
+		}
+		latest, err := mgr.latestNativeId(entry.BookId)
+		if nil != err {
+			return nil, err
+		}
+		books = append(books, &ShelfBook{
+			Book:        book,
+			Position:    entry.Position,
+			AddedAt:     entry.AddedAt,
+			OpenedAt:    entry.OpenedAt,
+			NewChapters: latest > entry.SeenNativeId,
+		})
+	}
+	return books, nil
+}
+
+func (mgr *BookMgr) addShelfBook(body interface{}) ([]*ShelfBook, error) {
+	p, err := mgr.parseShelfReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	book, err := mgr.store.GetBook(p.BookId)
+	if nil != err {
+		return nil, err
+	}
+	if nil == book {
+		return nil, errors.New("Invalid parameter")
+	}
+
+	entries, err := mgr.store.QueryShelfBooks(p.ClientId)
+	if nil != err {
+		return nil, err
+	}
+	position := 0
+	for _, entry := range entries {
+		if position <= entry.Position {
+			position = entry.Position + 1
+		}
+	}
+	seen, err := mgr.latestNativeId(p.BookId)
+	if nil != err {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	entry := ShelfEntry{ClientId: p.ClientId, BookId: p.BookId, Position: position,
+		AddedAt: now, OpenedAt: now, SeenNativeId: seen}
+	_, err = mgr.store.AddShelfBook(&entry)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.QueryShelf(p.ClientId)
+}
+
+func (mgr *BookMgr) removeShelfBook(body interface{}) ([]*ShelfBook, error) {
+	p, err := mgr.parseShelfReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	ok, err := mgr.store.RemoveShelfBook(p.ClientId, p.BookId)
+	if nil != err {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("Invalid parameter")
+	}
+	return mgr.QueryShelf(p.ClientId)
+}
+
+func (mgr *BookMgr) orderShelfBooks(body interface{}) ([]*ShelfBook, error) {
+	p, err := mgr.parseShelfReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+	entries, err := mgr.store.QueryShelfBooks(p.ClientId)
+	if nil != err {
+		return nil, err
+	}
+
+	onShelf := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		onShelf[entry.BookId] = true
+	}
+	// Books listed in the request come first, the rest keep their order.
+	ordered := make([]string, 0, len(entries))
+	for _, bookId := range p.BookIds {
+		if !onShelf[bookId] {
+			return nil, errors.New("Invalid parameter")
+		}
+		onShelf[bookId] = false
+		ordered = append(ordered, bookId)
+	}
+	for _, entry := range entries {
+		if onShelf[entry.BookId] {
+			ordered = append(ordered, entry.BookId)
+		}
+	}
+
+	err = mgr.store.SetShelfPositions(p.ClientId, ordered)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.QueryShelf(p.ClientId)
+}
+
+func (mgr *BookMgr) markShelfBookOpened(clientId string, bookId string) error {
+	seen, err := mgr.latestNativeId(bookId)
+	if nil != err {
+		return err
+	}
+	return mgr.store.MarkShelfBookOpened(clientId, bookId, seen, time.Now().Unix())
+}
+
+func (mgr *BookMgr) ExcludeShelfBooks(clientId string, token string, books []*Book) ([]*Book, error) {
+	if "" == clientId && "" == token {
+		return books, nil
+	}
+	owner, err := mgr.ownerId(clientId, token)
+	if nil != err {
+		return nil, err
+	}
+	entries, err := mgr.store.QueryShelfBooks(owner)
+	if nil != err {
+		return nil, err
+	}
+	onShelf := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		onShelf[entry.BookId] = true
+	}
+	filtered := make([]*Book, 0, len(books))
+	for _, book := range books {
+		if !onShelf[book.Id] {
+			filtered = append(filtered, book)
+		}
+	}
+	return filtered, nil
+}
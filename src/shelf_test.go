@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func shelfBookIds(books []*ShelfBook) []string {
+	ids := make([]string, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.Id)
+	}
+	return ids
+}
+
+func TestShelfAddOrderRemove(t *testing.T) {
+	setTestBookMgr(t)
+	for _, id := range []string{"1", "2", "3", "1"} {
+		body := `{"action":"add","body":{"client_id":"c","book_id":"` + id + `"}}`
+		if resp := doRequest(t, ShelfProc, "POST", "/shelf", body, nil); 0 != resp.Code {
+			t.Fatalf("POST /shelf add %s: got %+v", id, resp)
+		}
+	}
+
+	var shelf shelfResp
+	resp := doRequest(t, ShelfProc, "GET", "/shelf?client_id=c", "", &shelf)
+	if 0 != resp.Code || "1,2,3" != strings.Join(shelfBookIds(shelf.Books), ",") {
+		t.Errorf("GET /shelf: got %+v %v", resp, shelfBookIds(shelf.Books))
+	}
+
+	body := `{"action":"order","body":{"client_id":"c","book_ids":["3","1"]}}`
+	resp = doRequest(t, ShelfProc, "POST", "/shelf", body, &shelf)
+	if 0 != resp.Code || "3,1,2" != strings.Join(shelfBookIds(shelf.Books), ",") {
+		t.Errorf("POST /shelf order: got %+v %v", resp, shelfBookIds(shelf.Books))
+	}
+
+	body = `{"action":"del","body":{"client_id":"c","book_id":"1"}}`
+	resp = doRequest(t, ShelfProc, "POST", "/shelf", body, &shelf)
+	if 0 != resp.Code || "3,2" != strings.Join(shelfBookIds(shelf.Books), ",") {
+		t.Errorf("POST /shelf del: got %+v %v", resp, shelfBookIds(shelf.Books))
+	}
+
+	invalid := []string{
+		`{"action":"add","body":{"client_id":"c","book_id":"404"}}`,
+		`{"action":"del","body":{"client_id":"c","book_id":"1"}}`,
+		`{"action":"order","body":{"client_id":"c","book_ids":["1"]}}`,
+		`{"action":"add","body":{"book_id":"1"}}`,
+		`{"action":"x","body":{"client_id":"c"}}`,
+	}
+	for _, body := range invalid {
+		if resp = doRequest(t, ShelfProc, "POST", "/shelf", body, nil); -3 != resp.Code {
+			t.Errorf("POST /shelf %s: expected -3, got %+v", body, resp)
+		}
+	}
+	if resp = doRequest(t, ShelfProc, "GET", "/shelf", "", nil); -2 != resp.Code {
+		t.Errorf("GET /shelf without client: expected -2, got %+v", resp)
+	}
+}
+
+func TestShelfNewChapters(t *testing.T) {
+	store := setTestBookMgr(t)
+	if _, err := mgr.addShelfBook(map[string]string{"client_id": "c", "book_id": "1"}); nil != err {
+		t.Fatal(err)
+	}
+	books, _ := mgr.QueryShelf("c")
+	if 1 != len(books) || books[0].NewChapters {
+		t.Fatalf("QueryShelf: expected no new chapters, got %+v", books)
+	}
+
+	store.AddBookChapters("1", []*Chapter{{NativeId: 3, Id: "c3", Title: "第三章"}})
+	books, _ = mgr.QueryShelf("c")
+	if !books[0].NewChapters {
+		t.Error("QueryShelf: expected new chapters")
+	}
+
+	if _, err := mgr.addBookRead(map[string]string{"client_id": "c", "book_id": "1"}); nil != err {
+		t.Fatal(err)
+	}
+	books, _ = mgr.QueryShelf("c")
+	if books[0].NewChapters {
+		t.Error("QueryShelf: new chapters should clear after reading")
+	}
+}
+
+func TestShelfRecommendExcludesShelf(t *testing.T) {
+	store := setTestBookMgr(t)
+	store.SetRecommendBooks("shelf_recommend_books", false, []recommendBook{{Id: "1"}, {Id: "2"}, {Id: "3"}}, nil)
+	mgr.addShelfBook(map[string]string{"client_id": "c", "book_id": "2"})
+
+	var list booksListResp
+	resp := doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=shelfrecommend&client_id=c", "", &list)
+	if 0 != resp.Code || !equalIds(list.Books, "1", "3") {
+		t.Errorf("GET shelfrecommend: got %+v %v", resp, bookIds(list.Books))
+	}
+	resp = doRequest(t, BookMgrsProc, "GET", "/books?a=l&c=shelfrecommend", "", &list)
+	if 0 != resp.Code || !equalIds(list.Books, "1", "2", "3") {
+		t.Errorf("GET shelfrecommend without client: got %+v %v", resp, bookIds(list.Books))
+	}
+}
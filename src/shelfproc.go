@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+type shelfResp struct {
+	Books []*ShelfBook `json:"books"`
+}
+
+func shelfGet(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	clientId := ""
+	if 0 < len(r.Form["client_id"]) {
+		clientId = r.Form["client_id"][0]
+	}
+	token := ""
+	if 0 < len(r.Form["token"]) {
+		token = r.Form["token"][0]
+	}
+	if "" == clientId && "" == token {
+		Response(w, -2, "Invalid parameter", nil)
+		return
+	}
+
+	books, err := mgr.GetShelf(clientId, token)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", shelfResp{Books: books})
+}
+
+func operateShelf(p apiPostP) (*shelfResp, error) {
+	var books []*ShelfBook
+	var err error
+
+	switch p.Action {
+	case "add":
+		books, err = mgr.addShelfBook(p.Body)
+	case "del":
+		books, err = mgr.removeShelfBook(p.Body)
+	case "order":
+		books, err = mgr.orderShelfBooks(p.Body)
+	default:
+		err = errors.New("Invalid action")
+	}
+
+	if nil != err {
+		return nil, err
+	}
+	return &shelfResp{Books: books}, nil
+}
+
+func shelfPost(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		Response(w, -1, err.Error(), nil)
+		return
+	}
+
+	var p apiPostP
+	err = json.Unmarshal(body, &p)
+	if nil != err {
+		Response(w, -2, err.Error(), nil)
+		return
+	}
+
+	resp, err := operateShelf(p)
+	if nil != err {
+		Response(w, -3, err.Error(), nil)
+		return
+	}
+	Response(w, 0, "", resp)
+}
+
+func ShelfProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		shelfGet(w, r)
+	case "POST":
+		shelfPost(w, r)
+	}
+}
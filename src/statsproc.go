@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+type statsResp struct {
+	Counters CounterStats `json:"counters"`
+}
+
+func statsGet(w http.ResponseWriter, r *http.Request) {
+	admin, err := authenticateAdmin(r, nil, time.Now())
+	if nil == err && roleAdmin != admin.Role {
+		err = errAdminForbidden
+	}
+	if nil != err {
+		adminError(w, err)
+		return
+	}
+
+	Response(w, 0, "", statsResp{Counters: mgr.CounterStats()})
+}
+
+func StatsProc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		statsGet(w, r)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	suggestBook   = "book"
+	suggestAuthor = "author"
+	suggestClass  = "class"
+	suggestHot    = "hot"
+
+	defaultSuggestSize = 10
+	maxSuggestSize     = 50
+	defaultHotWords    = 100
+)
+
+var suggestRanks = map[string]int{
+	suggestBook:   0,
+	suggestAuthor: 1,
+	suggestClass:  2,
+	suggestHot:    3,
+}
+
+type Suggestion struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	BookId string `json:"book_id,omitempty"`
+}
+
+type suggestEntry struct {
+	Suggestion
+	weight int
+	text   pinyinText
+}
+
+func (entry *suggestEntry) suggestKeys() []rune {
+	if 0 == len(entry.text) {
+		return nil
+	}
+	unit := entry.text[0]
+	keys := make([]rune, 0, len(unit.syllables)+1)
+	if 0 != unit.han {
+		keys = append(keys, unit.han)
+	}
+	for _, syllable := range unit.syllables {
+		keys = append(keys, syllable[0])
+	}
+	return keys
+}
+
+func (index *SearchIndex) buildSuggestions() map[rune][]*suggestEntry {
+	entries := make([]*suggestEntry, 0, len(index.books))
+	authors := make(map[string]*suggestEntry)
+	classes := make(map[string]*suggestEntry)
+	names := make(map[string]bool)
+	for _, doc := range index.books {
+		book := doc.book
+		if "" != book.Name {
+			entries = append(entries, &suggestEntry{
+				Suggestion: Suggestion{Type: suggestBook, Text: book.Name, BookId: book.Id},
+				weight:     book.Score,
+				text:       doc.namePinyin,
+			})
+			names[book.Name] = true
+		}
+		if author, ok := authors[book.Author]; ok {
+			if book.Score > author.weight {
+				author.weight = book.Score
+				author.BookId = book.Id
+			}
+		} else if "" != book.Author {
+			authors[book.Author] = &suggestEntry{
+				Suggestion: Suggestion{Type: suggestAuthor, Text: book.Author, BookId: book.Id},
+				weight:     book.Score,
+				text:       doc.authorPinyin,
+			}
+		}
+		if class, ok := classes[book.Class]; ok {
+			class.weight++
+		} else if "" != book.Class {
+			classes[book.Class] = &suggestEntry{
+				Suggestion: Suggestion{Type: suggestClass, Text: book.Class},
+				weight:     1,
+				text:       newPinyinText(book.Class),
+			}
+		}
+	}
+	for _, author := range authors {
+		entries = append(entries, author)
+	}
+	for _, class := range classes {
+		entries = append(entries, class)
+	}
+	for i, word := range index.hotWords {
+		_, isAuthor := authors[word]
+		_, isClass := classes[word]
+		if _, isName := names[word]; isName || isAuthor || isClass {
+			continue
+		}
+		entries = append(entries, &suggestEntry{
+			Suggestion: Suggestion{Type: suggestHot, Text: word},
+			weight:     len(index.hotWords) - i,
+			text:       newPinyinText(word),
+		})
+	}
+
+	buckets := make(map[rune][]*suggestEntry)
+	for _, entry := range entries {
+		seen := make(map[rune]bool)
+		for _, key := range entry.suggestKeys() {
+			if !seen[key] {
+				seen[key] = true
+				buckets[key] = append(buckets[key], entry)
+			}
+		}
+	}
+	return buckets
+}
+
+func (index *SearchIndex) SetHotWords(words []string) {
+	index.mutex.Lock()
+	index.hotWords = words
+	index.suggestions = nil
+	index.mutex.Unlock()
+}
+
+// Buckets are never modified once built, callers read them without the lock.
+func (index *SearchIndex) suggestBuckets() map[rune][]*suggestEntry {
+	index.mutex.RLock()
+	buckets := index.suggestions
+	index.mutex.RUnlock()
+	if nil != buckets {
+		return buckets
+	}
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if nil == index.suggestions {
+		index.suggestions = index.buildSuggestions()
+	}
+	return index.suggestions
+}
+
+type suggestHit struct {
+	entry *suggestEntry
+	exact bool
+}
+
+func (index *SearchIndex) Suggest(prefix string, size int) []*Suggestion {
+	query := pinyinKey(prefix)
+	suggestions := make([]*Suggestion, 0)
+	if 0 == len(query) || 0 >= size {
+		return suggestions
+	}
+
+	hits := make([]suggestHit, 0)
+	for _, entry := range index.suggestBuckets()[query[0]] {
+		if ok, whole := entry.text.matchPrefix(query); ok {
+			hits = append(hits, suggestHit{entry: entry, exact: whole})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.exact != b.exact {
+			return a.exact
+		}
+		if suggestRanks[a.entry.Type] != suggestRanks[b.entry.Type] {
+			return suggestRanks[a.entry.Type] < suggestRanks[b.entry.Type]
+		}
+		if a.entry.weight != b.entry.weight {
+			return a.entry.weight > b.entry.weight
+		}
+		return a.entry.Text < b.entry.Text
+	})
+
+	if len(hits) > size {
+		hits = hits[:size]
+	}
+	for _, hit := range hits {
+		suggestion := hit.entry.Suggestion
+		suggestions = append(suggestions, &suggestion)
+	}
+	return suggestions
+}
+
+func suggestSize(size int) int {
+	if 0 >= size {
+		size = cfg.Search.SuggestSize
+	}
+	if 0 >= size {
+		size = defaultSuggestSize
+	}
+	if size > maxSuggestSize {
+		size = maxSuggestSize
+	}
+	return size
+}
+
+func (mgr *BookMgr) SuggestBooks(prefix string, size int) []*Suggestion {
+	return mgr.index.Suggest(prefix, suggestSize(size))
+}
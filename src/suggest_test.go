@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+)
+
+type testSuggestion struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	BookId string `json:"book_id"`
+}
+
+func suggestTexts(suggestions []testSuggestion) []string {
+	texts := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		texts = append(texts, suggestion.Type+":"+suggestion.Text+":"+suggestion.BookId)
+	}
+	return texts
+}
+
+func TestSuggestBooks(t *testing.T) {
+	store := setTestBookMgr(t)
+	store.AddBook(&Book{Id: "4", Name: "斗罗大陆", Author: "唐家三少", Class: "玄幻", Score: 99})
+	store.IncSearchWord("斗气", 5)
+	store.IncSearchWord("斗破苍穹", 9)
+	store.IncSearchWord("唐门", 2)
+	err := mgr.RebuildSearchIndex()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		target string
+		expect []string
+	}{
+		{"/books?a=suggest&c=斗", []string{"book:斗罗大陆:4", "book:斗破苍穹:1", "hot:斗气:"}},
+		{"/books?a=suggest&c=dp", []string{"book:斗破苍穹:1"}},
+		{"/books?a=suggest&c=斗po", []string{"book:斗破苍穹:1"}},
+		{"/books?a=suggest&c=tang", []string{"author:唐家三少:4", "hot:唐门:"}},
+		{"/books?a=suggest&c=xuanhuan", []string{"class:玄幻:"}},
+		{"/books?a=suggest&c=d&n=2", []string{"book:斗罗大陆:4", "book:斗破苍穹:1"}},
+		{"/books?a=suggest&c=", []string{}},
+	}
+	for _, c := range cases {
+		var result struct {
+			Suggestions []testSuggestion `json:"suggestions"`
+		}
+		resp := doRequest(t, BookMgrsProc, "GET", c.target, "", &result)
+		got := suggestTexts(result.Suggestions)
+		if 0 != resp.Code || !equalStrings(got, c.expect...) {
+			t.Errorf("%s: got %d %v", c.target, resp.Code, got)
+		}
+	}
+
+	resp := doRequest(t, BookMgrsProc, "GET", "/books?a=suggest&c=d&n=x", "", nil)
+	if -2 != resp.Code {
+		t.Errorf("invalid n: expected -2, got %d", resp.Code)
+	}
+}
+
+func TestTopSearchWords(t *testing.T) {
+	store := newTestBookStore(t)
+	store.IncSearchWord("斗气", 5)
+	store.IncSearchWord("斗破苍穹", 9)
+	store.IncSearchWord("唐门", 2)
+
+	// Hot words keep their old order, suggestions want the most searched.
+	if words, _ := store.QueryHotWords(2); !equalStrings(words, "唐门", "斗气") {
+		t.Errorf("QueryHotWords: got %v", words)
+	}
+	if words, _ := store.QueryTopSearchWords(2); !equalStrings(words, "斗破苍穹", "斗气") {
+		t.Errorf("QueryTopSearchWords: got %v", words)
+	}
+}
+
+func TestSuggestFollowsReindex(t *testing.T) {
+	store := setTestBookMgr(t)
+	if 0 != len(mgr.SuggestBooks("zx", 0)) {
+		t.Fatal("zx: expected no suggestion before the book exists")
+	}
+
+	store.AddBook(&Book{Id: "4", Name: "诛仙", Author: "萧鼎", Class: "仙侠", Score: 85})
+	err := mgr.ReindexBook("4")
+	if nil != err {
+		t.Fatal(err)
+	}
+	suggestions := mgr.SuggestBooks("zx", 0)
+	if 1 != len(suggestions) || "4" != suggestions[0].BookId {
+		t.Errorf("zx: got %v", suggestions)
+	}
+}
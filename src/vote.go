@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVotesPerBookDaily = 1
+	defaultVotesDailyBudget  = 10
+)
+
+type Vote struct {
+	Id        int64  `json:"id"`
+	BookId    string `json:"book_id"`
+	ClientId  string `json:"client_id"`
+	Day       string `json:"day"`
+	CreatedAt int64  `json:"created_at"`
+	Revoked   bool   `json:"revoked"`
+}
+
+func voteDay(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func votesPerBookDaily() int {
+	if 0 >= cfg.Vote.PerBookDaily {
+		return defaultVotesPerBookDaily
+	}
+	return cfg.Vote.PerBookDaily
+}
+
+func votesDailyBudget() int {
+	if 0 >= cfg.Vote.DailyBudget {
+		return defaultVotesDailyBudget
+	}
+	return cfg.Vote.DailyBudget
+}
+
+// Votes keep the client id they were cast with, an account also answers for
+// the votes of the clients linked to it.
+func (mgr *BookMgr) voteOwners(owner string) ([]string, error) {
+	if !strings.HasPrefix(owner, accountOwnerPrefix) {
+		return []string{owner}, nil
+	}
+	accountId, err := strconv.ParseInt(strings.TrimPrefix(owner, accountOwnerPrefix), 10, 64)
+	if nil != err {
+		return nil, err
+	}
+	clientIds, err := mgr.store.QueryAccountClients(accountId)
+	if nil != err {
+		return nil, err
+	}
+	return append([]string{owner}, clientIds...), nil
+}
+
+func (mgr *BookMgr) countVotes(owners []string, bookId string, day string) (int, error) {
+	total := 0
+	for _, owner := range owners {
+		count, err := mgr.store.CountClientVotes(owner, bookId, day)
+		if nil != err {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func (mgr *BookMgr) addBookVote(body interface{}) (*Book, error) {
+	p, err := mgr.parseOwnerReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+
+	book, err := mgr.store.GetBook(p.BookId)
+	if nil != err {
+		return nil, err
+	}
+	if nil == book {
+		return nil, errors.New("Invalid parameter")
+	}
+
+	mgr.voteMutex.Lock()
+	defer mgr.voteMutex.Unlock()
+
+	owners, err := mgr.voteOwners(p.ClientId)
+	if nil != err {
+		return nil, err
+	}
+	now := time.Now()
+	day := voteDay(now)
+	count, err := mgr.countVotes(owners, "", day)
+	if nil != err {
+		return nil, err
+	}
+	if count >= votesDailyBudget() {
+		return nil, errors.New("Daily vote budget exceeded")
+	}
+	count, err = mgr.countVotes(owners, p.BookId, day)
+	if nil != err {
+		return nil, err
+	}
+	if count >= votesPerBookDaily() {
+		return nil, errors.New("Already voted today")
+	}
+
+	vote := Vote{BookId: p.BookId, ClientId: p.ClientId, Day: day, CreatedAt: now.Unix()}
+	err = mgr.store.AddVote(&vote)
+	if nil != err {
+		return nil, err
+	}
+
+	mgr.counters.Add(p.BookId, BookCounters{Votes: 1})
+	return mgr.applyPendingCounters(book), nil
+}
+
+func (mgr *BookMgr) RevokeVote(id int64) (*Vote, error) {
+	vote, err := mgr.store.RevokeVote(id)
+	if nil != err {
+		return nil, err
+	}
+	if nil == vote {
+		return nil, errors.New("Invalid parameter")
+	}
+	mgr.counters.Add(vote.BookId, BookCounters{Votes: -1})
+	return vote, nil
+}
+
+func (mgr *BookMgr) revokeBookVote(body interface{}) (*Book, error) {
+	p, err := mgr.parseOwnerReqBody(body)
+	if nil != err {
+		return nil, err
+	}
+
+	owners, err := mgr.voteOwners(p.ClientId)
+	if nil != err {
+		return nil, err
+	}
+	var last *Vote
+	for _, owner := range owners {
+		votes, err := mgr.store.QueryClientVotes(owner, p.BookId, voteDay(time.Now()))
+		if nil != err {
+			return nil, err
+		}
+		for _, vote := range votes {
+			if nil == last || vote.Id > last.Id {
+				last = vote
+			}
+		}
+	}
+	if nil == last {
+		return nil, errors.New("Invalid parameter")
+	}
+	_, err = mgr.RevokeVote(last.Id)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.getBook(p.BookId)
+}
+
+type voteAuditP struct {
+	BookId string `json:"book_id"`
+	Id     int64  `json:"id"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+func parseVoteAuditBody(admin *AdminKeyCfg, body interface{}) (*voteAuditP, error) {
+	if roleAdmin != admin.Role {
+		return nil, errAdminForbidden
+	}
+	bodyJSON, err := json.Marshal(body)
+	if nil != err {
+		return nil, err
+	}
+	var p voteAuditP
+	err = json.Unmarshal(bodyJSON, &p)
+	if nil != err {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (mgr *BookMgr) QueryBookVotes(admin *AdminKeyCfg, body interface{}) ([]*Vote, error) {
+	p, err := parseVoteAuditBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	if "" == p.BookId {
+		return nil, errors.New("Invalid parameter")
+	}
+	if 0 > p.Offset {
+		p.Offset = 0
+	}
+	if 0 >= p.Limit {
+		p.Limit = mgr.PageCount
+	}
+	return mgr.store.QueryBookVotes(p.BookId, p.Offset, p.Limit)
+}
+
+func (mgr *BookMgr) RevokeBookVote(admin *AdminKeyCfg, body interface{}) (*Vote, error) {
+	p, err := parseVoteAuditBody(admin, body)
+	if nil != err {
+		return nil, err
+	}
+	return mgr.RevokeVote(p.Id)
+}
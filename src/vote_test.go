@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func postBookVote(t *testing.T, action string, bookId string, clientId string, p interface{}) testResp {
+	body := `{"action":"` + action + `","key":"vote","body":{"book_id":"` + bookId + `","client_id":"` + clientId + `"}}`
+	return doRequest(t, BookProc, "POST", "/book", body, p)
+}
+
+func TestBookPostVote(t *testing.T) {
+	store := setTestBookMgr(t)
+	var p bookPostRespP
+	resp := postBookVote(t, "add", "1", "c1", &p)
+	if 0 != resp.Code || nil == p.Book || 4 != p.Book.TotalVotes {
+		t.Fatalf("POST /book vote: got %+v %+v", resp, p.Book)
+	}
+
+	resp = postBookVote(t, "add", "1", "c1", nil)
+	if -3 != resp.Code {
+		t.Errorf("POST /book vote twice: expected -3, got %+v", resp)
+	}
+	resp = postBookVote(t, "add", "1", "c2", &p)
+	if 0 != resp.Code || 5 != p.Book.TotalVotes {
+		t.Errorf("POST /book vote other client: got %+v %+v", resp, p.Book)
+	}
+
+	mgr.FlushCounters()
+	if book, _ := store.GetBook("1"); 5 != book.TotalVotes {
+		t.Errorf("votes: expected 5 stored, got %d", book.TotalVotes)
+	}
+
+	resp = postBookVote(t, "add", "404", "c1", nil)
+	if -3 != resp.Code {
+		t.Errorf("POST /book vote unknown book: expected -3, got %+v", resp)
+	}
+}
+
+func TestBookPostVoteBudget(t *testing.T) {
+	old := cfg.Vote
+	cfg.Vote = VoteCfg{PerBookDaily: 1, DailyBudget: 2}
+	defer func() {
+		cfg.Vote = old
+	}()
+
+	setTestBookMgr(t)
+	for _, id := range []string{"1", "2"} {
+		if resp := postBookVote(t, "add", id, "c1", nil); 0 != resp.Code {
+			t.Fatalf("POST /book vote %s: got %+v", id, resp)
+		}
+	}
+	if resp := postBookVote(t, "add", "3", "c1", nil); -3 != resp.Code {
+		t.Errorf("POST /book vote over budget: expected -3, got %+v", resp)
+	}
+}
+
+func TestBookPostVoteRevoke(t *testing.T) {
+	setTestBookMgr(t)
+	postBookVote(t, "add", "3", "c1", nil)
+
+	var p bookPostRespP
+	resp := postBookVote(t, "del", "3", "c1", &p)
+	if 0 != resp.Code || 5 != p.Book.TotalVotes {
+		t.Errorf("POST /book unvote: got %+v %+v", resp, p.Book)
+	}
+	if resp = postBookVote(t, "del", "3", "c1", nil); -3 != resp.Code {
+		t.Errorf("POST /book unvote twice: expected -3, got %+v", resp)
+	}
+	if resp = postBookVote(t, "add", "3", "c1", &p); 0 != resp.Code || 6 != p.Book.TotalVotes {
+		t.Errorf("POST /book vote after revoke: got %+v %+v", resp, p.Book)
+	}
+
+	defer setTestAdminKeys()()
+	var votes bookVotesResp
+	body := `{"action":"votes","body":{"book_id":"3"}}`
+	resp = doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key")
+	json.Unmarshal(resp.Body, &votes)
+	if 0 != resp.Code || 2 != len(votes.Votes) || votes.Votes[0].Revoked || !votes.Votes[1].Revoked ||
+		"c1" != votes.Votes[1].ClientId {
+		t.Errorf("POST /books votes: got %+v %+v", resp, votes)
+	}
+	if resp = doRequest(t, BookMgrsProc, "POST", "/books", body, nil); -4 != resp.Code {
+		t.Errorf("POST /books votes without key: expected -4, got %+v", resp)
+	}
+	if resp = doAdminRequest(t, BookMgrsProc, "/books", body, "editor-key"); -5 != resp.Code {
+		t.Errorf("POST /books votes as editor: expected -5, got %+v", resp)
+	}
+	if resp = doRequest(t, BookProc, "GET", "/book?a=votes&id=3", "", nil); 0 == resp.Code {
+		t.Errorf("GET /book?a=votes: expected the audit log to be gone, got %+v", resp)
+	}
+
+	body = fmt.Sprintf(`{"action":"revokevote","body":{"id":%d}}`, votes.Votes[0].Id)
+	resp = doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key")
+	if 0 != resp.Code {
+		t.Fatalf("POST /books revokevote: got %+v", resp)
+	}
+	if resp = doAdminRequest(t, BookMgrsProc, "/books", body, "admin-key"); -3 != resp.Code {
+		t.Errorf("POST /books revokevote twice: expected -3, got %+v", resp)
+	}
+	if book, _ := mgr.getBook("3"); 5 != book.TotalVotes {
+		t.Errorf("votes after admin revoke: expected 5, got %d", book.TotalVotes)
+	}
+}